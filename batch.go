@@ -0,0 +1,283 @@
+package ttl
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Result is the outcome of loading one key with a BatchLoaderFunction
+type Result[V any] struct {
+	Data V
+	TTL  time.Duration
+	Err  error
+}
+
+// BatchLoaderFunction can be supplied to retrieve all the keys missed by GetMulti with a single call.
+// Keys missing from the returned map get ErrNotFound, an error fails all the keys.
+type BatchLoaderFunction[K comparable, V any] func(keys []K) (map[K]Result[V], error)
+
+// SetBatchLoaderFunction sets the function GetMulti uses to load all the missing keys at once.
+// Without it the missing keys are loaded concurrently with the loader function.
+func (cache *Cache[K, V]) SetBatchLoaderFunction(loader BatchLoaderFunction[K, V]) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.batchLoaderFunction = loader
+}
+
+// GetMulti looks up the keys taking the lock once, the items are touched as with Get. The keys missing from
+// the cache are loaded with a single call to the batch loader function. Keys already being loaded, for example by
+// Get, are not loaded again but waited for, in the same way Get waits for the keys loaded by GetMulti.
+// The returned map holds the keys that were found or loaded, the error is the one returned by the batch loader.
+// Without a batch loader it is the error of the loader function for the first key that failed to load.
+func (cache *Cache[K, V]) GetMulti(keys []K) (map[K]V, error) {
+	cache.mutex.Lock()
+	if cache.isShutDown {
+		cache.mutex.Unlock()
+		return nil, ErrClosed
+	}
+	results := make(map[K]V, len(keys))
+	seen := make(map[K]struct{}, len(keys))
+	var misses []K
+	var stale []K
+	triggerExpirationNotification := false
+	for _, key := range keys {
+		if _, duplicate := seen[key]; duplicate {
+			continue
+		}
+		seen[key] = struct{}{}
+		cache.metrics.Hits++
+		item, exists, notify := cache.getItem(key)
+		triggerExpirationNotification = triggerExpirationNotification || notify
+		if !exists {
+			cache.metrics.Misses++
+			misses = append(misses, key)
+			continue
+		}
+		if cache.evictionPolicy != nil {
+			cache.evictionPolicy.Access(key)
+		}
+		if item.err != nil {
+			cache.metrics.NegativeHits++
+			continue
+		}
+		cache.metrics.Retrievals++
+		if item.isStale(cache.clock.Now()) {
+			cache.metrics.StaleRetrievals++
+			stale = append(stale, key)
+		}
+		results[key] = item.data
+	}
+
+	loaderFunction := cache.loaderFunction
+	batchLoaderFunction := cache.batchLoaderFunction
+	if loaderFunction != nil {
+		for _, key := range stale {
+			cache.refresh(context.Background(), key, loaderFunction)
+		}
+	}
+	var err error
+	if len(misses) > 0 && batchLoaderFunction != nil {
+		var loaded map[K]V
+		loaded, err = cache.loadBatch(misses, batchLoaderFunction)
+		for key, data := range loaded {
+			results[key] = data
+		}
+	} else if len(misses) > 0 && loaderFunction != nil {
+		cache.mutex.Unlock()
+		var lock sync.Mutex
+		var wg sync.WaitGroup
+		errs := make([]error, len(misses))
+		for i, key := range misses {
+			wg.Add(1)
+			go func(i int, key K) {
+				defer wg.Done()
+				cache.mutex.Lock()
+				data, _, loadErr := cache.load(context.Background(), key, loaderFunction)
+				if loadErr != nil {
+					errs[i] = loadErr
+					return
+				}
+				lock.Lock()
+				results[key] = data
+				lock.Unlock()
+			}(i, key)
+		}
+		wg.Wait()
+		for _, loadErr := range errs {
+			if loadErr != nil {
+				err = loadErr
+				break
+			}
+		}
+	} else {
+		cache.mutex.Unlock()
+	}
+
+	if triggerExpirationNotification {
+		cache.notifyExpiration()
+	}
+	return results, err
+}
+
+// loadBatch loads the keys with the batch loader function, joining the loads already in progress.
+// It must be called holding the cache lock and it releases it.
+func (cache *Cache[K, V]) loadBatch(keys []K, batchLoaderFunction BatchLoaderFunction[K, V]) (map[K]V, error) {
+	var claimed []K
+	calls := make(map[K]*loaderCall[V], len(keys))
+	for _, key := range keys {
+		call, inProgress := cache.loaderCalls[key]
+		if inProgress {
+			cache.metrics.LoaderDeduplicated++
+		} else {
+			// the keys claimed by the batch are seen as single key loads by Get
+			call = cache.startLoaderCall(context.Background(), key)
+			claimed = append(claimed, key)
+		}
+		call.waiters++
+		calls[key] = call
+	}
+	cache.mutex.Unlock()
+
+	var err error
+	if len(claimed) > 0 {
+		err = cache.loadClaimed(claimed, calls, batchLoaderFunction)
+	}
+
+	loaded := make(map[K]V, len(keys))
+	for key, call := range calls {
+		<-call.done
+		if call.result.err == nil {
+			loaded[key] = call.result.data
+		}
+	}
+	return loaded, err
+}
+
+// loadClaimed calls the batch loader function for the keys claimed by a batch and finishes their loads.
+// The loads are finished even when the batch loader panics, so that their callers do not wait forever.
+func (cache *Cache[K, V]) loadClaimed(claimed []K, calls map[K]*loaderCall[V], batchLoaderFunction BatchLoaderFunction[K, V]) error {
+	var results map[K]Result[V]
+	defer func() {
+		for _, key := range claimed {
+			result, found := results[key]
+			if !found {
+				result = Result[V]{Err: ErrLoaderPanic}
+			}
+			cache.finishLoaderCall(key, calls[key], loaderResult[V]{data: result.Data, ttl: result.TTL, err: result.Err})
+		}
+	}()
+	var err error
+	results, err = cache.invokeBatchLoader(claimed, batchLoaderFunction)
+	return err
+}
+
+// invokeBatchLoader calls the batch loader function and adds its results to the cache
+func (cache *Cache[K, V]) invokeBatchLoader(keys []K, batchLoaderFunction BatchLoaderFunction[K, V]) (map[K]Result[V], error) {
+	start := time.Now()
+	loaded, err := batchLoaderFunction(keys)
+	cache.loaderLatency.observe(start)
+
+	results := make(map[K]Result[V], len(keys))
+	for _, key := range keys {
+		result, found := loaded[key]
+		if err != nil {
+			result = Result[V]{Err: err}
+		} else if !found {
+			result = Result[V]{Err: ErrNotFound}
+		}
+		results[key] = result
+	}
+	cache.mutex.Lock()
+	if err == nil {
+		cache.metrics.LoaderSuccesses++
+	} else {
+		cache.metrics.LoaderFailures++
+	}
+	cache.mutex.Unlock()
+	for key, setErr := range cache.setBatch(results) {
+		results[key] = Result[V]{Err: setErr}
+	}
+	return results, err
+}
+
+// setBatch adds the results to the cache holding the lock once, results with an error are negative entries.
+// It returns the errors of the results that could not be added.
+func (cache *Cache[K, V]) setBatch(results map[K]Result[V]) map[K]error {
+	errs := make(map[K]error)
+	cache.mutex.Lock()
+	if cache.isShutDown {
+		cache.mutex.Unlock()
+		for key, result := range results {
+			if result.Err == nil {
+				errs[key] = ErrClosed
+			}
+		}
+		return errs
+	}
+	var inserted []K
+	for key, result := range results {
+		isNew, citem, err := cache.setLocked(key, result.Data, result.TTL, costFromWeigher, result.Err)
+		if err == nil && result.Err == nil {
+			err = cache.logSet(citem)
+		}
+		if err != nil {
+			errs[key] = err
+		}
+		if isNew {
+			inserted = append(inserted, key)
+		}
+	}
+	newItemCallback := cache.newItemCallback
+	cache.mutex.Unlock()
+	if newItemCallback != nil {
+		for _, key := range inserted {
+			newItemCallback(key, results[key].Data)
+		}
+	}
+	cache.notifyExpiration()
+	return errs
+}
+
+// SetMultiWithTTL adds the items to the cache with the same ttl, taking the lock once.
+// All the items are added even when one of them fails, the error of one of the failures is returned.
+func (cache *Cache[K, V]) SetMultiWithTTL(items map[K]V, ttl time.Duration) error {
+	defer cache.setLatency.observe(time.Now())
+	results := make(map[K]Result[V], len(items))
+	for key, data := range items {
+		results[key] = Result[V]{Data: data, TTL: ttl}
+	}
+	for _, err := range cache.setBatch(results) {
+		return err
+	}
+	return nil
+}
+
+// RemoveMulti removes the keys from the cache taking the lock once, as Remove does for each of them.
+// Returns the amount of keys that were present.
+func (cache *Cache[K, V]) RemoveMulti(keys []K) (int, error) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if cache.isShutDown {
+		return 0, ErrClosed
+	}
+	return cache.removeKeys(keys)
+}
+
+// removeKeys removes the keys that are present while holding the lock, returns the amount removed
+func (cache *Cache[K, V]) removeKeys(keys []K) (int, error) {
+	removed := 0
+	var walErr error
+	for _, key := range keys {
+		item, exists := cache.items[key]
+		if !exists {
+			continue
+		}
+		cache.removeItem(item, Removed)
+		removed++
+		if err := cache.logKey(walRemove, key); err != nil && walErr == nil {
+			walErr = err
+		}
+	}
+	return removed, walErr
+}
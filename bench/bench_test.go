@@ -5,11 +5,11 @@ import (
 	"testing"
 	"time"
 
-	ttlcache "github.com/asgarciap/ttl/v3"
+	ttlcache "github.com/asgarciap/ttl/v4"
 )
 
 func BenchmarkCacheSetWithoutTTL(b *testing.B) {
-	cache := ttlcache.NewCache()
+	cache := ttlcache.NewCache[string, string]()
 	defer cache.Close()
 
 	for n := 0; n < b.N; n++ {
@@ -21,7 +21,7 @@ func BenchmarkCacheSetWithoutTTL(b *testing.B) {
 }
 
 func BenchmarkCacheSetWithGlobalTTL(b *testing.B) {
-	cache := ttlcache.NewCache()
+	cache := ttlcache.NewCache[string, string]()
 	defer cache.Close()
 
 	if cache.SetTTL(time.Duration(50*time.Millisecond)) != nil {
@@ -36,7 +36,7 @@ func BenchmarkCacheSetWithGlobalTTL(b *testing.B) {
 }
 
 func BenchmarkCacheSetWithTTL(b *testing.B) {
-	cache := ttlcache.NewCache()
+	cache := ttlcache.NewCache[string, string]()
 	defer cache.Close()
 
 	for n := 0; n < b.N; n++ {
@@ -46,3 +46,35 @@ func BenchmarkCacheSetWithTTL(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkCacheGetParallel(b *testing.B) {
+	cache := ttlcache.NewCache[string, string]()
+	defer cache.Close()
+
+	benchmarkGetParallel(b, cache)
+}
+
+func BenchmarkShardedCacheGetParallel(b *testing.B) {
+	cache := ttlcache.NewShardedCache[string, string](0)
+	defer cache.Close()
+
+	benchmarkGetParallel(b, cache)
+}
+
+func benchmarkGetParallel(b *testing.B, cache ttlcache.SimpleCache[string, string]) {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = fmt.Sprint(i)
+		if err := cache.SetWithTTL(keys[i], "value", time.Hour); err != nil {
+			b.Errorf("Error when inserting item %v", err)
+		}
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for n := 0; pb.Next(); n++ {
+			if _, err := cache.Get(keys[n%len(keys)]); err != nil {
+				b.Errorf("Error when getting item %v", err)
+			}
+		}
+	})
+}
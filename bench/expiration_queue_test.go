@@ -0,0 +1,117 @@
+package bench
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	ttlcache "github.com/asgarciap/ttl/v4"
+)
+
+type queueEntry struct {
+	expiresAt time.Time
+	index     int
+}
+
+func (entry *queueEntry) ExpiresAt() time.Time {
+	return entry.expiresAt
+}
+
+func (entry *queueEntry) SetIndex(index int) {
+	entry.index = index
+}
+
+func (entry *queueEntry) GetIndex() int {
+	return entry.index
+}
+
+var queueSizes = []int{1000000, 10000000}
+
+func expirationQueues() map[string]func() ttlcache.ExpirationQueue {
+	return map[string]func() ttlcache.ExpirationQueue{
+		"Heap": func() ttlcache.ExpirationQueue {
+			return ttlcache.NewExpirationHeap()
+		},
+		"Wheel": func() ttlcache.ExpirationQueue {
+			return ttlcache.NewTimingWheel(time.Millisecond)
+		},
+	}
+}
+
+// BenchmarkExpirationQueueUpdate measures moving an entry to a later expiration, as a Get touching an item does
+func BenchmarkExpirationQueueUpdate(b *testing.B) {
+	for _, size := range queueSizes {
+		for name, newQueue := range expirationQueues() {
+			b.Run(fmt.Sprintf("%s/%d", name, size), func(b *testing.B) {
+				now := time.Now()
+				queue := newQueue()
+				queue.Advance(now)
+				entries := make([]queueEntry, size)
+				random := rand.New(rand.NewSource(1))
+				for i := range entries {
+					entries[i].expiresAt = now.Add(time.Duration(random.Int63n(int64(time.Hour))))
+					queue.Add(&entries[i])
+				}
+				b.ResetTimer()
+				for n := 0; n < b.N; n++ {
+					entry := &entries[random.Intn(size)]
+					entry.expiresAt = now.Add(time.Hour + time.Duration(n))
+					queue.Update(entry)
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkExpirationQueueReplace measures removing an entry and adding a new one, as items are replaced in a full cache
+func BenchmarkExpirationQueueReplace(b *testing.B) {
+	for _, size := range queueSizes {
+		for name, newQueue := range expirationQueues() {
+			b.Run(fmt.Sprintf("%s/%d", name, size), func(b *testing.B) {
+				now := time.Now()
+				queue := newQueue()
+				queue.Advance(now)
+				entries := make([]*queueEntry, size)
+				random := rand.New(rand.NewSource(1))
+				for i := range entries {
+					entries[i] = &queueEntry{expiresAt: now.Add(time.Duration(random.Int63n(int64(time.Hour))))}
+					queue.Add(entries[i])
+				}
+				b.ResetTimer()
+				for n := 0; n < b.N; n++ {
+					i := random.Intn(size)
+					queue.Remove(entries[i])
+					entries[i].expiresAt = now.Add(time.Duration(random.Int63n(int64(time.Hour))))
+					queue.Add(entries[i])
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkCacheGetWithExpirationQueue measures Get on a cache holding 1M items, the items are touched on every hit
+func BenchmarkCacheGetWithExpirationQueue(b *testing.B) {
+	const size = 1000000
+	keys := make([]string, size)
+	for i := range keys {
+		keys[i] = fmt.Sprint(i)
+	}
+	for name, newQueue := range expirationQueues() {
+		b.Run(name, func(b *testing.B) {
+			cache := ttlcache.NewCache[string, string]()
+			defer cache.Close()
+			cache.SetExpirationQueue(newQueue)
+			for _, key := range keys {
+				cache.SetWithTTL(key, "value", time.Hour+time.Duration(rand.Int63n(int64(time.Hour))))
+			}
+			random := rand.New(rand.NewSource(1))
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				if _, err := cache.Get(keys[random.Intn(size)]); err != nil {
+					b.Errorf("Error when getting item %v", err)
+				}
+			}
+		})
+	}
+}
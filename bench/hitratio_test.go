@@ -0,0 +1,85 @@
+package bench
+
+import (
+	"math/rand"
+	"testing"
+
+	ttlcache "github.com/asgarciap/ttl/v4"
+)
+
+const (
+	traceCapacity = 1000
+	traceLength   = 200000
+)
+
+// zipfTrace returns a trace of keys following a Zipf distribution
+func zipfTrace(seed int64, s float64, length int) []uint64 {
+	zipf := rand.NewZipf(rand.New(rand.NewSource(seed)), s, 1, 1<<20)
+	trace := make([]uint64, length)
+	for i := range trace {
+		trace[i] = zipf.Uint64()
+	}
+	return trace
+}
+
+// withScan interleaves one-off keys with the trace, as a loader would do for keys read only once
+func withScan(trace []uint64) []uint64 {
+	scanned := make([]uint64, 0, 2*len(trace))
+	for i, key := range trace {
+		scanned = append(scanned, key, 1<<32+uint64(i))
+	}
+	return scanned
+}
+
+// hitRatio replays the trace against a size limited cache, misses are loaded in the cache
+func hitRatio(t *testing.T, policy ttlcache.EvictionPolicy[uint64], trace []uint64) float64 {
+	cache := ttlcache.NewCache[uint64, uint64]()
+	defer cache.Close()
+	cache.SetCacheSizeLimit(traceCapacity)
+	cache.SetEvictionPolicy(policy)
+
+	hits := 0
+	for _, key := range trace {
+		if _, err := cache.Get(key); err == nil {
+			hits++
+			continue
+		}
+		if err := cache.Set(key, key); err != nil {
+			t.Fatalf("Error when inserting item %v", err)
+		}
+	}
+	return float64(hits) / float64(len(trace))
+}
+
+func policies() map[string]ttlcache.EvictionPolicy[uint64] {
+	return map[string]ttlcache.EvictionPolicy[uint64]{
+		"lru":     ttlcache.NewLRUPolicy[uint64](),
+		"lfu":     ttlcache.NewLFUPolicy[uint64](),
+		"fifo":    ttlcache.NewFIFOPolicy[uint64](),
+		"tinylfu": ttlcache.NewTinyLFUPolicy[uint64](traceCapacity),
+	}
+}
+
+func TestHitRatioZipf(t *testing.T) {
+	trace := zipfTrace(1, 1.01, traceLength)
+	ratios := make(map[string]float64)
+	for name, policy := range policies() {
+		ratios[name] = hitRatio(t, policy, trace)
+		t.Logf("%s hit ratio: %.4f", name, ratios[name])
+	}
+	if ratios["tinylfu"] < ratios["lru"] || ratios["tinylfu"] < ratios["fifo"] {
+		t.Errorf("Expected tinylfu to have the best hit ratio, got %v", ratios)
+	}
+}
+
+func TestHitRatioZipfWithScan(t *testing.T) {
+	trace := withScan(zipfTrace(2, 1.01, traceLength))
+	ratios := make(map[string]float64)
+	for name, policy := range policies() {
+		ratios[name] = hitRatio(t, policy, trace)
+		t.Logf("%s hit ratio: %.4f", name, ratios[name])
+	}
+	if ratios["tinylfu"] < ratios["lru"]*1.2 {
+		t.Errorf("Expected tinylfu to keep frequent keys during scans, got %v", ratios)
+	}
+}
@@ -1,56 +1,92 @@
 package ttl
 
 import (
+	"context"
+	"errors"
 	"sync"
 	"time"
-
-	"golang.org/x/sync/singleflight"
 )
 
 // CheckExpireCallback is used as a callback for an external check on item expiration
-type CheckExpireCallback func(key string, value interface{}) bool
+type CheckExpireCallback[K comparable, V any] func(key K, value V) bool
 
 // ExpireCallback is used as a callback on item expiration or when notifying of an item new to the cache
 // Note that ExpireReasonCallback will be the succesor of this function in the next major release.
-type ExpireCallback func(key string, value interface{})
+type ExpireCallback[K comparable, V any] func(key K, value V)
 
 // ExpireReasonCallback is used as a callback on item expiration with extra information why the item expired.
-type ExpireReasonCallback func(key string, reason EvictionReason, value interface{})
+type ExpireReasonCallback[K comparable, V any] func(key K, reason EvictionReason, value V)
+
+// LoaderFunctionContext is a LoaderFunction that receives the context of the Get call, see GetContext
+type LoaderFunctionContext[K comparable, V any] func(ctx context.Context, key K) (data V, ttl time.Duration, err error)
+
+// RefreshErrorCallback is used as a callback when a background refresh of an item fails, the item keeps its value
+type RefreshErrorCallback[K comparable] func(key K, err error)
+
+// Weigher is used to calculate the cost of an item, see SetMaxCost
+type Weigher[K comparable, V any] func(key K, value V) int64
 
 // LoaderFunction can be supplied to retrieve an item where a cache miss occurs. Supply an item specific ttl or Duration.Zero
-type LoaderFunction func(key string) (data interface{}, ttl time.Duration, err error)
+type LoaderFunction[K comparable, V any] func(key K) (data V, ttl time.Duration, err error)
 
 // SimpleCache interface enables a quick-start. Interface for basic usage.
-type SimpleCache interface {
-	Get(key string) (interface{}, error)
-	GetWithTTL(key string) (interface{}, time.Duration, error)
-	Set(key string, data interface{}) error
+type SimpleCache[K comparable, V any] interface {
+	Get(key K) (V, error)
+	GetWithTTL(key K) (V, time.Duration, error)
+	Set(key K, data V) error
 	SetTTL(ttl time.Duration) error
-	SetWithTTL(key string, data interface{}, ttl time.Duration) error
-	Remove(key string) error
+	SetWithTTL(key K, data V, ttl time.Duration) error
+	Remove(key K) error
 	Close() error
 	Purge() error
 }
 
-// Cache is a synchronized map of items that can auto-expire once stale
-type Cache struct {
+// Cache is a synchronized map of items that can auto-expire once stale.
+// K is the type of the keys and V the type of the values stored in the cache.
+type Cache[K comparable, V any] struct {
 	mutex                  sync.Mutex
 	ttl                    time.Duration
-	items                  map[string]*item
-	loaderLock             *singleflight.Group
-	expireCallback         ExpireCallback
-	expireReasonCallback   ExpireReasonCallback
-	checkExpireCallback    CheckExpireCallback
-	newItemCallback        ExpireCallback
-	expirationHeap         *ExpirationHeap
-	expirationNotification chan bool
+	items                  map[K]*item[K, V]
+	expireCallback         ExpireCallback[K, V]
+	expireReasonCallback   ExpireReasonCallback[K, V]
+	checkExpireCallback    CheckExpireCallback[K, V]
+	newItemCallback        ExpireCallback[K, V]
+	expirationQueue        ExpirationQueue
+	newExpirationQueue     func() ExpirationQueue
+	expirationNotification *expirationSignal
 	expirationTime         time.Time
 	skipTTLExtension       bool
+	manual                 bool
+	janitor                *janitorEntry
+	callbackDispatcher     *CallbackDispatcher
 	shutdownSignal         chan (chan struct{})
 	isShutDown             bool
-	loaderFunction         LoaderFunction
+	loaderFunction         LoaderFunctionContext[K, V]
+	batchLoaderFunction    BatchLoaderFunction[K, V]
+	loaderCalls            map[K]*loaderCall[V]
 	sizeLimit              int
+	evictionPolicy         EvictionPolicy[K]
+	staleTTL               time.Duration
+	refreshAhead           float64
+	negativeTTL            time.Duration
+	negativeFilter         func(err error) bool
+	refreshErrorCallback   RefreshErrorCallback[K]
+	maxCost                int64
+	totalCost              int64
+	version                uint64
+	weigher                Weigher[K, V]
+	keyCodec               Codec[K]
+	valueCodec             Codec[V]
+	wal                    *writeAheadLog
+	walSync                time.Duration
 	metrics                Metrics
+	subscriptions          map[*subscription[K, V]]struct{}
+	loaderLatency          *latencyHistogram
+	getLatency             *latencyHistogram
+	setLatency             *latencyHistogram
+	tags                   map[string]map[K]struct{}
+	keyIndex               *radixTree[K]
+	clock                  Clock
 }
 
 // EvictionReason is an enum that explains why an item was evicted
@@ -65,6 +101,8 @@ const (
 	Expired
 	// Closed : the cache was closed
 	Closed
+	// ExpiredNegative : the time to live of a cached loader error is over
+	ExpiredNegative
 )
 
 const (
@@ -72,17 +110,38 @@ const (
 	ErrClosed = constError("cache already closed")
 	// ErrNotFound indicates that the requested key is not present in the cache
 	ErrNotFound = constError("key not found")
+	// ErrCostExceeded is raised when the cost of an item alone is bigger than the max cost of the cache
+	ErrCostExceeded = constError("item cost exceeds the cache max cost")
+	// ErrInvalidSnapshot is raised by Load and OpenWAL when the data was not written by Save or the write-ahead log
+	ErrInvalidSnapshot = constError("invalid cache snapshot")
+	// ErrWALOpen is raised by OpenWAL when the cache already has a write-ahead log
+	ErrWALOpen = constError("write-ahead log already open")
+	// ErrVersionMismatch is matched by the VersionMismatchError of SetIfVersion, with errors.Is
+	ErrVersionMismatch = constError("item version mismatch")
+	// ErrPrefixUnsupported is raised by RemoveByPrefix when the keys of the cache are not strings
+	ErrPrefixUnsupported = constError("prefix removal needs string keys")
+	// ErrInvalidOption is matched by the OptionError of NewCacheWithOptions, with errors.Is
+	ErrInvalidOption = constError("invalid cache option")
+	// ErrCallbackPanic is matched by the CallbackPanicError reported by a CallbackDispatcher, with errors.Is
+	ErrCallbackPanic = constError("callback panicked")
+	// ErrLoaderPanic is returned to the callers waiting for the keys of a batch loader call that panicked
+	ErrLoaderPanic = constError("loader panicked")
 )
 
+// costFromWeigher is used as the cost of an item when it has to be calculated with the Weigher
+const costFromWeigher int64 = -1
+
 type constError string
 
 func (err constError) Error() string {
 	return string(err)
 }
 
-func (cache *Cache) getItem(key string) (*item, bool, bool) {
+func (cache *Cache[K, V]) getItem(key K) (*item[K, V], bool, bool) {
+	cache.expireLazily()
+	now := cache.clock.Now()
 	item, exists := cache.items[key]
-	if !exists || item.expired() {
+	if !exists || item.expired(now) {
 		return nil, false, false
 	}
 
@@ -91,73 +150,97 @@ func (cache *Cache) getItem(key string) (*item, bool, bool) {
 			item.ttl = cache.ttl
 		}
 
-		if !cache.skipTTLExtension {
-			item.touch()
+		// a stale item keeps its expiration, it is refreshed by the loader instead
+		if !cache.skipTTLExtension && !item.isStale(now) && item.err == nil {
+			item.touch(now)
 		}
-		cache.expirationHeap.Update(item)
+		cache.expirationQueue.Update(item)
 	}
 
 	expirationNotification := false
-	if cache.expirationTime.After(time.Now().Add(item.ttl)) {
+	if cache.expirationTime.After(item.ExpiresAt()) {
 		expirationNotification = true
 	}
 	return item, exists, expirationNotification
 }
 
-func (cache *Cache) startExpirationProcessing() {
-	timer := time.NewTimer(time.Hour)
-	for {
-		var sleepTime time.Duration
-		cache.mutex.Lock()
-		if cache.expirationHeap.Len() > 0 {
-			sleepTime = time.Until(cache.expirationHeap.Peek().ExpiresAt())
-			if sleepTime < 0 && cache.expirationHeap.Peek().ExpiresAt().IsZero() {
-				sleepTime = time.Hour
-			} else if sleepTime < 0 {
-				sleepTime = time.Microsecond
-			}
-			if cache.ttl > 0 {
-				sleepTime = min(sleepTime, cache.ttl)
-			}
-
-		} else if cache.ttl > 0 {
-			sleepTime = cache.ttl
-		} else {
+// nextExpiration calculates how long the expiration processing can sleep before the next cleanjob
+func (cache *Cache[K, V]) nextExpiration() time.Duration {
+	var sleepTime time.Duration
+	if cache.expirationQueue.Len() > 0 {
+		now := cache.clock.Now()
+		cache.expirationQueue.Advance(now)
+		nextExpiration := cache.expirationQueue.NextExpiration()
+		sleepTime = nextExpiration.Sub(now)
+		if sleepTime < 0 && nextExpiration.IsZero() {
 			sleepTime = time.Hour
+		} else if sleepTime < 0 {
+			sleepTime = 0
+		}
+		if cache.ttl > 0 {
+			sleepTime = min(sleepTime, cache.ttl)
 		}
 
-		cache.expirationTime = time.Now().Add(sleepTime)
+	} else if cache.ttl > 0 {
+		sleepTime = cache.ttl
+	} else {
+		sleepTime = time.Hour
+	}
+	return sleepTime
+}
+
+// notifyExpiration wakes up the expiration processing so it recalculates its sleep time
+func (cache *Cache[K, V]) notifyExpiration() {
+	if cache.janitor != nil {
+		cache.janitor.notify()
+		return
+	}
+	cache.expirationNotification.notify()
+}
+
+func (cache *Cache[K, V]) startExpirationProcessing() {
+	for {
+		timer := cache.expirationNotification.current()
+		cache.mutex.Lock()
+		sleepTime := cache.nextExpiration()
+		cache.expirationTime = cache.clock.Now().Add(sleepTime)
 		cache.mutex.Unlock()
-		timer.Reset(sleepTime)
+		cache.expirationNotification.reset(timer, sleepTime)
 		select {
 		case shutdownFeedback := <-cache.shutdownSignal:
-			timer.Stop()
+			cache.expirationNotification.stop()
 			cache.mutex.Lock()
-			if cache.expirationHeap.Len() > 0 {
+			if cache.expirationQueue.Len() > 0 {
 				cache.evictjob(Closed)
 			}
 			cache.mutex.Unlock()
 			shutdownFeedback <- struct{}{}
 			return
-		case <-timer.C:
-			timer.Stop()
+		case <-timer.C():
 			cache.mutex.Lock()
-			if cache.expirationHeap.Len() == 0 {
+			if cache.expirationQueue.Len() == 0 {
 				cache.mutex.Unlock()
 				continue
 			}
 			cache.cleanjob()
 			cache.mutex.Unlock()
 
-		case <-cache.expirationNotification:
-			timer.Stop()
+		case <-cache.expirationNotification.notification:
 			continue
 		}
 	}
 }
 
-func (cache *Cache) checkExpirationCallback(item *item, reason EvictionReason) {
-	if cache.expireCallback != nil {
+func (cache *Cache[K, V]) checkExpirationCallback(item *item[K, V], reason EvictionReason) {
+	if item.err != nil && reason != ExpiredNegative {
+		// a cached loader error has no value, only its expiration is reported to the reason callback
+		return
+	}
+	if cache.callbackDispatcher != nil {
+		cache.dispatchExpirationCallback(item, reason)
+		return
+	}
+	if cache.expireCallback != nil && item.err == nil {
 		go cache.expireCallback(item.key, item.data)
 	}
 	if cache.expireReasonCallback != nil {
@@ -165,34 +248,100 @@ func (cache *Cache) checkExpirationCallback(item *item, reason EvictionReason) {
 	}
 }
 
-func (cache *Cache) removeItem(item *item, reason EvictionReason) {
+func (cache *Cache[K, V]) removeItem(item *item[K, V], reason EvictionReason) {
+	if reason == Expired && item.err != nil {
+		reason = ExpiredNegative
+	}
 	switch reason {
+	case Removed:
+		cache.metrics.Removed++
 	case EvictedSize:
 		cache.metrics.EvictedFull++
 	case Expired:
 		cache.metrics.EvictedExpired++
 	case Closed:
 		cache.metrics.EvictedClosed++
+	case ExpiredNegative:
+		cache.metrics.EvictedNegative++
 	}
 	cache.checkExpirationCallback(item, reason)
-	cache.expirationHeap.Remove(item)
+	if reason == Expired {
+		cache.publish(EventExpired, item, reason)
+	} else {
+		cache.publish(EventRemoved, item, reason)
+	}
+	cache.detachItem(item)
+}
+
+// detachItem drops an item from the cache bookkeeping without any notification
+func (cache *Cache[K, V]) detachItem(item *item[K, V]) {
+	cache.expirationQueue.Remove(item)
 	delete(cache.items, item.key)
+	cache.unindexItem(item)
+	cache.totalCost -= item.cost
+	if cache.evictionPolicy != nil {
+		cache.evictionPolicy.Remove(item.key)
+	}
+}
 
+// evictItem removes the item chosen by the eviction policy to make room for a new one.
+// Without a policy the item closest to expire is evicted. Returns false when there was nothing to evict.
+func (cache *Cache[K, V]) evictItem() bool {
+	var victim *item[K, V]
+	if cache.evictionPolicy != nil {
+		if key, ok := cache.evictionPolicy.Victim(); ok {
+			victim = cache.items[key]
+		}
+	} else if entry := cache.expirationQueue.Peek(); entry != nil {
+		victim = entry.(*item[K, V])
+	}
+	if victim == nil {
+		return false
+	}
+	cache.removeItem(victim, EvictedSize)
+	cache.logEviction(victim.key)
+	return true
+}
+
+// itemCost calculates the cost of an item with the Weigher, every item costs 1 without it
+func (cache *Cache[K, V]) itemCost(key K, data V) int64 {
+	if cache.weigher == nil {
+		return 1
+	}
+	return cache.weigher(key, data)
 }
 
-func (cache *Cache) evictjob(reason EvictionReason) {
-	for citem := cache.expirationHeap.Peek(); citem != nil; citem = cache.expirationHeap.Peek() {
-		cache.removeItem(citem.(*item), reason)
+// exceedsMaxCost checks if adding cost to the cache would go over the max cost
+func (cache *Cache[K, V]) exceedsMaxCost(cost int64) bool {
+	return cache.maxCost > 0 && cache.totalCost+cost > cache.maxCost
+}
+
+func (cache *Cache[K, V]) evictjob(reason EvictionReason) {
+	for citem := cache.expirationQueue.Peek(); citem != nil; citem = cache.expirationQueue.Peek() {
+		cache.removeItem(citem.(*item[K, V]), reason)
 	}
 }
 
-func (cache *Cache) cleanjob() {
-	for citem := cache.expirationHeap.Peek(); citem != nil && citem.(*item).expired(); citem = cache.expirationHeap.Peek() {
-		nitem := citem.(*item)
-		if cache.checkExpireCallback != nil {
+func (cache *Cache[K, V]) cleanjob() {
+	now := cache.clock.Now()
+	cache.expirationQueue.Advance(now)
+	for citem := cache.expirationQueue.Peek(); citem != nil; citem = cache.expirationQueue.Peek() {
+		nitem := citem.(*item[K, V])
+		if !nitem.expired(now) {
+			if !nitem.refreshDue(now) {
+				return
+			}
+			nitem.refreshAt = time.Time{}
+			cache.expirationQueue.Update(citem)
+			if cache.loaderFunction != nil {
+				cache.refresh(context.Background(), nitem.key, cache.loaderFunction)
+			}
+			continue
+		}
+		if cache.checkExpireCallback != nil && nitem.err == nil {
 			if !cache.checkExpireCallback(nitem.key, nitem.data) {
-				nitem.touch()
-				cache.expirationHeap.Update(citem)
+				nitem.touch(now)
+				cache.expirationQueue.Update(citem)
 				continue
 			}
 		}
@@ -202,17 +351,32 @@ func (cache *Cache) cleanjob() {
 
 // Close calls Purge after stopping the goroutine that does ttl checking, for a clean shutdown.
 // The cache is no longer cleaning up after the first call to Close, repeated calls are safe and return ErrClosed.
-func (cache *Cache) Close() error {
+func (cache *Cache[K, V]) Close() error {
 	cache.mutex.Lock()
 	var err error
 	if !cache.isShutDown {
 		cache.isShutDown = true
-		cache.mutex.Unlock()
-		feedback := make(chan struct{})
-		cache.shutdownSignal <- feedback
-		<-feedback
+		if cache.manual || cache.janitor != nil {
+			if cache.janitor != nil {
+				cache.janitor.deregister()
+			}
+			if cache.expirationQueue.Len() > 0 {
+				cache.evictjob(Closed)
+			}
+			cache.mutex.Unlock()
+		} else {
+			cache.mutex.Unlock()
+			feedback := make(chan struct{})
+			cache.shutdownSignal <- feedback
+			<-feedback
+		}
 		close(cache.shutdownSignal)
-		err = cache.Purge()
+		err = cache.closeWAL()
+		if purgeErr := cache.Purge(); err == nil {
+			err = purgeErr
+		}
+		cache.closeSubscriptions()
+		cache.waitCallbacks()
 	} else {
 		cache.mutex.Unlock()
 		err = ErrClosed
@@ -221,88 +385,215 @@ func (cache *Cache) Close() error {
 }
 
 // Set is a thread-safe way to add new items to the map.
-func (cache *Cache) Set(key string, data interface{}) error {
+func (cache *Cache[K, V]) Set(key K, data V) error {
 	return cache.SetWithTTL(key, data, ItemExpireWithGlobalTTL)
 }
 
 // SetWithTTL is a thread-safe way to add new items to the map with individual ttl.
-func (cache *Cache) SetWithTTL(key string, data interface{}, ttl time.Duration) error {
+// The cost of the item is calculated with the Weigher when the cache has a max cost.
+func (cache *Cache[K, V]) SetWithTTL(key K, data V, ttl time.Duration) error {
+	return cache.SetWithCost(key, data, ttl, costFromWeigher)
+}
+
+// SetWithCost is a thread-safe way to add new items to the map with individual ttl and cost.
+// As many items as needed are evicted to keep the total cost under the max cost of the cache.
+// A negative cost is calculated with the Weigher. Returns ErrCostExceeded when the item alone exceeds the max cost.
+func (cache *Cache[K, V]) SetWithCost(key K, data V, ttl time.Duration, cost int64) error {
+	defer cache.setLatency.observe(time.Now())
+	return cache.set(key, data, ttl, cost, nil)
+}
+
+// set adds an item to the cache. With a loaderErr the item is a negative entry for the key, it is only
+// added when negative caching accepts the error and it never replaces an item that did not expire.
+func (cache *Cache[K, V]) set(key K, data V, ttl time.Duration, cost int64, loaderErr error) error {
 	cache.mutex.Lock()
 	if cache.isShutDown {
 		cache.mutex.Unlock()
 		return ErrClosed
 	}
+	isNew, citem, err := cache.setLocked(key, data, ttl, cost, loaderErr)
+	if err != nil {
+		cache.mutex.Unlock()
+		return err
+	}
+	if loaderErr == nil {
+		err = cache.logSet(citem)
+	}
+	cache.mutex.Unlock()
+	if isNew && cache.newItemCallback != nil {
+		cache.newItemCallback(key, data)
+	}
+	cache.notifyExpiration()
+	return err
+}
+
+// setLocked does the work of set while holding the lock. It returns the stored item, nil when a
+// negative entry was not added, and whether the key is new to the cache.
+func (cache *Cache[K, V]) setLocked(key K, data V, ttl time.Duration, cost int64, loaderErr error) (bool, *item[K, V], error) {
+	if loaderErr != nil {
+		current, found := cache.items[key]
+		if !cache.cacheableError(loaderErr) || (found && !current.expired(cache.clock.Now())) {
+			return false, nil, nil
+		}
+		ttl = cache.negativeTTL
+		cost = 1
+	}
+	if cost < 0 {
+		cost = cache.itemCost(key, data)
+	}
+	if cache.maxCost > 0 && cost > cache.maxCost {
+		return false, nil, ErrCostExceeded
+	}
 	citem, exists, _ := cache.getItem(key)
+	refreshAhead := cache.refreshAhead
+	if exists {
+		refreshAhead = citem.refreshAhead
+	}
+	if old, found := cache.items[key]; found && !exists {
+		cache.removeItem(old, Expired)
+	}
+	isNew := !exists || citem.err != nil
+	var tags []string
+	if exists && cache.exceedsMaxCost(cost-citem.cost) {
+		// the item must not be chosen to make room for its own update
+		tags = citem.tags
+		cache.detachItem(citem)
+		exists = false
+	}
 
 	if exists {
+		cache.totalCost += cost - citem.cost
 		citem.data = data
 		citem.ttl = ttl
+		citem.cost = cost
+		citem.err = loaderErr
+		if cache.evictionPolicy != nil {
+			cache.evictionPolicy.Access(key)
+		}
 	} else {
 		if cache.sizeLimit != 0 && len(cache.items) >= cache.sizeLimit {
-			cache.removeItem(cache.expirationHeap.Peek().(*item), EvictedSize)
+			cache.evictItem()
 		}
-		citem = newItem(key, data, ttl)
+		for cache.exceedsMaxCost(cost) && cache.evictItem() {
+		}
+		citem = newItem(key, data, ttl, cache.clock.Now())
+		citem.cost = cost
+		citem.err = loaderErr
 		cache.items[key] = citem
+		cache.indexItem(citem)
+		cache.setTags(citem, tags)
+		cache.totalCost += cost
+		if cache.evictionPolicy != nil {
+			cache.evictionPolicy.Add(key)
+		}
+	}
+	if loaderErr != nil {
+		cache.metrics.NegativeInserted++
+		isNew = false
+		// negative entries are neither served stale nor refreshed
+		refreshAhead = 0
+	} else {
+		cache.metrics.Inserted++
 	}
-	cache.metrics.Inserted++
 
 	if citem.ttl >= 0 && (citem.ttl > 0 || cache.ttl > 0) {
 		if cache.ttl > 0 && citem.ttl == 0 {
 			citem.ttl = cache.ttl
 		}
-		citem.touch()
+		citem.stale = 0
+		if loaderErr == nil {
+			citem.stale = cache.staleTTL
+		}
+		citem.refreshAhead = refreshAhead
+		citem.touch(cache.clock.Now())
 	}
 
+	cache.version++
+	citem.version = cache.version
+
 	if exists {
-		cache.expirationHeap.Update(citem)
+		cache.expirationQueue.Update(citem)
 	} else {
-		cache.expirationHeap.Add(citem)
+		cache.expirationQueue.Add(citem)
 	}
-
-	cache.mutex.Unlock()
-	if !exists && cache.newItemCallback != nil {
-		cache.newItemCallback(key, data)
+	if isNew {
+		cache.publish(EventInserted, citem, 0)
+	} else {
+		cache.publish(EventUpdated, citem, 0)
 	}
-	cache.expirationNotification <- true
-	return nil
+	return isNew, citem, nil
 }
 
 // Get is a thread-safe way to lookup items
 // Every lookup, also touches the item, hence extending it's life
-func (cache *Cache) Get(key string) (interface{}, error) {
+func (cache *Cache[K, V]) Get(key K) (V, error) {
 	data, _, err := cache.GetByLoader(key, nil)
 	return data, err
 }
 
 // GetWithTTL has exactly the same behaviour as Get but also returns
 // the remaining TTL for an specific item at the moment it its retrieved
-func (cache *Cache) GetWithTTL(key string) (interface{}, time.Duration, error) {
+func (cache *Cache[K, V]) GetWithTTL(key K) (V, time.Duration, error) {
 	return cache.GetByLoader(key, nil)
 }
 
+// GetContext is like Get but the loader function, when set with SetLoaderFunctionContext, receives the context.
+// The caller stops waiting for the loader when the context is done and gets the context error.
+func (cache *Cache[K, V]) GetContext(ctx context.Context, key K) (V, error) {
+	data, _, err := cache.GetByLoaderContext(ctx, key, nil)
+	return data, err
+}
+
 // GetByLoader can take a per key loader function (ie. to propagate context)
-func (cache *Cache) GetByLoader(key string, customLoaderFunction LoaderFunction) (interface{}, time.Duration, error) {
+func (cache *Cache[K, V]) GetByLoader(key K, customLoaderFunction LoaderFunction[K, V]) (V, time.Duration, error) {
+	var loaderFunction LoaderFunctionContext[K, V]
+	if customLoaderFunction != nil {
+		loaderFunction = withoutContext(customLoaderFunction)
+	}
+	return cache.GetByLoaderContext(context.Background(), key, loaderFunction)
+}
+
+// GetByLoaderContext can take a per key loader function that receives the context.
+// Concurrent calls for the same key share a single load. The load gets a context with the values of the context
+// of the caller that started it, and it is cancelled once all the callers waiting for it are gone.
+func (cache *Cache[K, V]) GetByLoaderContext(ctx context.Context, key K, customLoaderFunction LoaderFunctionContext[K, V]) (V, time.Duration, error) {
+	defer cache.getLatency.observe(time.Now())
 	cache.mutex.Lock()
 	if cache.isShutDown {
 		cache.mutex.Unlock()
-		return nil, 0, ErrClosed
+		var zero V
+		return zero, 0, ErrClosed
 	}
 
 	cache.metrics.Hits++
 	item, exists, triggerExpirationNotification := cache.getItem(key)
 
-	var dataToReturn interface{}
+	var dataToReturn V
 	ttlToReturn := time.Duration(0)
-	if exists {
+	stale := false
+	var err error
+	if exists && item.err != nil {
+		cache.metrics.NegativeHits++
+		if cache.evictionPolicy != nil {
+			cache.evictionPolicy.Access(key)
+		}
+		err = item.err
+	} else if exists {
 		cache.metrics.Retrievals++
+		if cache.evictionPolicy != nil {
+			cache.evictionPolicy.Access(key)
+		}
+		if item.isStale(cache.clock.Now()) {
+			cache.metrics.StaleRetrievals++
+			stale = true
+		}
 		dataToReturn = item.data
-		ttlToReturn = time.Until(item.expireAt)
+		ttlToReturn = item.expireAt.Sub(cache.clock.Now())
 		if ttlToReturn < 0 {
 			ttlToReturn = 0
 		}
 	}
 
-	var err error
 	if !exists {
 		cache.metrics.Misses++
 		err = ErrNotFound
@@ -313,52 +604,147 @@ func (cache *Cache) GetByLoader(key string, customLoaderFunction LoaderFunction)
 		loaderFunction = customLoaderFunction
 	}
 
+	if loaderFunction != nil && stale {
+		cache.refresh(ctx, key, loaderFunction)
+	}
+
 	if loaderFunction == nil || exists {
 		cache.mutex.Unlock()
 	}
 
 	if loaderFunction != nil && !exists {
-		type loaderResult struct {
-			data interface{}
-			ttl  time.Duration
-		}
-		ch := cache.loaderLock.DoChan(key, func() (interface{}, error) {
-			// cache is not blocked during io
-			invokeData, ttl, err := cache.invokeLoader(key, loaderFunction)
-			lr := &loaderResult{
-				data: invokeData,
-				ttl:  ttl,
-			}
-			return lr, err
-		})
-		cache.mutex.Unlock()
-		res := <-ch
-		dataToReturn = res.Val.(*loaderResult).data
-		ttlToReturn = res.Val.(*loaderResult).ttl
-		err = res.Err
+		dataToReturn, ttlToReturn, err = cache.load(ctx, key, loaderFunction)
 	}
 
 	if triggerExpirationNotification {
-		cache.expirationNotification <- true
+		cache.notifyExpiration()
 	}
 
 	return dataToReturn, ttlToReturn, err
 }
 
-func (cache *Cache) invokeLoader(key string, loaderFunction LoaderFunction) (dataToReturn interface{}, ttl time.Duration, err error) {
-	dataToReturn, ttl, err = loaderFunction(key)
+// load waits for the loader function to retrieve the key, joining a load already in progress.
+// It must be called holding the cache lock and it releases it.
+func (cache *Cache[K, V]) load(ctx context.Context, key K, loaderFunction LoaderFunctionContext[K, V]) (V, time.Duration, error) {
+	var zero V
+	if err := ctx.Err(); err != nil {
+		cache.mutex.Unlock()
+		return zero, 0, err
+	}
+
+	call, inProgress := cache.loaderCalls[key]
+	if inProgress {
+		cache.metrics.LoaderDeduplicated++
+	} else {
+		call = cache.startLoaderCall(ctx, key)
+		go func() {
+			// cache is not blocked during io
+			invokeData, ttl, err := cache.invokeLoader(call.ctx, key, loaderFunction)
+			cache.finishLoaderCall(key, call, loaderResult[V]{data: invokeData, ttl: ttl, err: err})
+		}()
+	}
+	call.waiters++
+	cache.mutex.Unlock()
+
+	select {
+	case <-call.done:
+		return call.result.data, call.result.ttl, call.result.err
+	case <-ctx.Done():
+		cache.leaveLoaderCall(key, call)
+		return zero, 0, ctx.Err()
+	}
+}
+
+// startLoaderCall registers a load of the key, the callers missing the key join it until it is finished.
+// It must be called holding the cache lock.
+func (cache *Cache[K, V]) startLoaderCall(ctx context.Context, key K) *loaderCall[V] {
+	call := newLoaderCall[V](ctx)
+	cache.loaderCalls[key] = call
+	return call
+}
+
+// finishLoaderCall hands the result of a load to its callers, the next caller missing the key starts a new load
+func (cache *Cache[K, V]) finishLoaderCall(key K, call *loaderCall[V], result loaderResult[V]) {
+	cache.mutex.Lock()
+	if cache.loaderCalls[key] == call {
+		delete(cache.loaderCalls, key)
+	}
+	cache.mutex.Unlock()
+	call.result = result
+	call.cancel()
+	close(call.done)
+}
+
+// leaveLoaderCall is called when a caller stops waiting for a load, the load is cancelled when nobody is waiting anymore.
+// An abandoned load is forgotten so that the next caller starts a new one instead of getting the cancellation error.
+func (cache *Cache[K, V]) leaveLoaderCall(key K, call *loaderCall[V]) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	call.waiters--
+	if call.waiters > 0 {
+		return
+	}
+	call.cancel()
+	if cache.loaderCalls[key] == call {
+		delete(cache.loaderCalls, key)
+	}
+}
+
+// refresh reloads the key in the background, sharing the load with callers missing the key.
+// The current value is kept when the loader fails.
+// It must be called holding the cache lock.
+func (cache *Cache[K, V]) refresh(ctx context.Context, key K, loaderFunction LoaderFunctionContext[K, V]) {
+	if _, inProgress := cache.loaderCalls[key]; inProgress {
+		return
+	}
+	call := cache.startLoaderCall(ctx, key)
+	// the refresh counts as a waiter, the callers that join it and go away do not cancel it
+	call.waiters++
+
+	go func() {
+		invokeData, ttl, err := cache.invokeLoader(call.ctx, key, loaderFunction)
+		cache.mutex.Lock()
+		refreshErrorCallback := cache.refreshErrorCallback
+		if err == nil {
+			cache.metrics.Refreshed++
+		} else {
+			cache.metrics.RefreshFailed++
+		}
+		cache.mutex.Unlock()
+		if err != nil && refreshErrorCallback != nil {
+			refreshErrorCallback(key, err)
+		}
+		cache.finishLoaderCall(key, call, loaderResult[V]{data: invokeData, ttl: ttl, err: err})
+	}()
+}
+
+func (cache *Cache[K, V]) invokeLoader(ctx context.Context, key K, loaderFunction LoaderFunctionContext[K, V]) (dataToReturn V, ttl time.Duration, err error) {
+	start := time.Now()
+	dataToReturn, ttl, err = loaderFunction(ctx, key)
+	cache.loaderLatency.observe(start)
+	cache.mutex.Lock()
+	if err == nil {
+		cache.metrics.LoaderSuccesses++
+	} else {
+		cache.metrics.LoaderFailures++
+	}
+	cache.mutex.Unlock()
 	if err == nil {
 		err = cache.SetWithTTL(key, dataToReturn, ttl)
 		if err != nil {
-			dataToReturn = nil
+			var zero V
+			dataToReturn = zero
 			ttl = 0
 		}
+	} else {
+		var zero V
+		cache.set(key, zero, 0, 0, err)
 	}
 	return dataToReturn, ttl, err
 }
 
 // Remove removes an item from the cache if it exists, triggers expiration callback when set. Can return ErrNotFound if the entry was not present.
-func (cache *Cache) Remove(key string) error {
+func (cache *Cache[K, V]) Remove(key K) error {
 	cache.mutex.Lock()
 	defer cache.mutex.Unlock()
 	if cache.isShutDown {
@@ -371,30 +757,32 @@ func (cache *Cache) Remove(key string) error {
 	}
 	cache.removeItem(object, Removed)
 
-	return nil
+	return cache.logKey(walRemove, key)
 }
 
 // Count returns the number of items in the cache. Returns zero when the cache has been closed.
-func (cache *Cache) Count() int {
+func (cache *Cache[K, V]) Count() int {
 	cache.mutex.Lock()
 	defer cache.mutex.Unlock()
 
 	if cache.isShutDown {
 		return 0
 	}
+	cache.expireLazily()
 	length := len(cache.items)
 	return length
 }
 
 // GetKeys returns all keys of items in the cache. Returns nil when the cache has been closed.
-func (cache *Cache) GetKeys() []string {
+func (cache *Cache[K, V]) GetKeys() []K {
 	cache.mutex.Lock()
 	defer cache.mutex.Unlock()
 
 	if cache.isShutDown {
 		return nil
 	}
-	keys := make([]string, len(cache.items))
+	cache.expireLazily()
+	keys := make([]K, len(cache.items))
 	i := 0
 	for k := range cache.items {
 		keys[i] = k
@@ -403,8 +791,52 @@ func (cache *Cache) GetKeys() []string {
 	return keys
 }
 
+// Range calls f for every item in the cache, in no particular order, until f returns false. The items are
+// copied at once, so f sees a consistent view of the cache and it can use the cache itself. Items are not
+// touched and their expiration does not change. expiresAt is zero for items that do not expire.
+// Expired and stale items as well as cached loader errors are skipped. Nothing happens when the cache has been closed.
+func (cache *Cache[K, V]) Range(f func(key K, value V, expiresAt time.Time) bool) {
+	for _, entry := range cache.liveEntries() {
+		if !f(entry.key, entry.data, entry.expiresAt) {
+			return
+		}
+	}
+}
+
+// rangeEntry is an item as seen by Range
+type rangeEntry[K comparable, V any] struct {
+	key       K
+	data      V
+	expiresAt time.Time
+}
+
+// liveEntries copies the items that did not expire
+func (cache *Cache[K, V]) liveEntries() []rangeEntry[K, V] {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if cache.isShutDown {
+		return nil
+	}
+	now := cache.clock.Now()
+	entries := make([]rangeEntry[K, V], 0, len(cache.items))
+	for _, item := range cache.items {
+		if item.err != nil {
+			continue
+		}
+		entry := rangeEntry[K, V]{key: item.key, data: item.data}
+		if item.ttl > 0 {
+			if !item.expireAt.After(now) {
+				continue
+			}
+			entry.expiresAt = item.expireAt
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
 // SetTTL sets the global TTL value for items in the cache, which can be overridden at the item level.
-func (cache *Cache) SetTTL(ttl time.Duration) error {
+func (cache *Cache[K, V]) SetTTL(ttl time.Duration) error {
 	cache.mutex.Lock()
 
 	if cache.isShutDown {
@@ -413,34 +845,37 @@ func (cache *Cache) SetTTL(ttl time.Duration) error {
 	}
 	cache.ttl = ttl
 	cache.mutex.Unlock()
-	cache.expirationNotification <- true
+	cache.notifyExpiration()
 	return nil
 }
 
-// SetExpirationCallback sets a callback that will be called when an item expires
-func (cache *Cache) SetExpirationCallback(callback ExpireCallback) {
+// SetExpirationCallback sets a callback that will be called when an item expires.
+// It is not called for the loader errors cached by SetNegativeCaching.
+func (cache *Cache[K, V]) SetExpirationCallback(callback ExpireCallback[K, V]) {
 	cache.mutex.Lock()
 	defer cache.mutex.Unlock()
 	cache.expireCallback = callback
 }
 
-// SetExpirationReasonCallback sets a callback that will be called when an item expires, includes reason of expiry
-func (cache *Cache) SetExpirationReasonCallback(callback ExpireReasonCallback) {
+// SetExpirationReasonCallback sets a callback that will be called when an item expires, includes reason of expiry.
+// A loader error cached by SetNegativeCaching is only reported once it expires, with ExpiredNegative and a zero value.
+func (cache *Cache[K, V]) SetExpirationReasonCallback(callback ExpireReasonCallback[K, V]) {
 	cache.mutex.Lock()
 	defer cache.mutex.Unlock()
 	cache.expireReasonCallback = callback
 }
 
 // SetCheckExpirationCallback sets a callback that will be called when an item is about to expire
-// in order to allow external code to decide whether the item expires or remains for another TTL cycle
-func (cache *Cache) SetCheckExpirationCallback(callback CheckExpireCallback) {
+// in order to allow external code to decide whether the item expires or remains for another TTL cycle.
+// The loader errors cached by SetNegativeCaching always expire without calling it.
+func (cache *Cache[K, V]) SetCheckExpirationCallback(callback CheckExpireCallback[K, V]) {
 	cache.mutex.Lock()
 	defer cache.mutex.Unlock()
 	cache.checkExpireCallback = callback
 }
 
 // SetNewItemCallback sets a callback that will be called when a new item is added to the cache
-func (cache *Cache) SetNewItemCallback(callback ExpireCallback) {
+func (cache *Cache[K, V]) SetNewItemCallback(callback ExpireCallback[K, V]) {
 	cache.mutex.Lock()
 	defer cache.mutex.Unlock()
 	cache.newItemCallback = callback
@@ -449,7 +884,7 @@ func (cache *Cache) SetNewItemCallback(callback ExpireCallback) {
 // SkipTTLExtensionOnHit allows the user to change the cache behaviour. When this flag is set to true it will
 // no longer extend TTL of items when they are retrieved using Get, or when their expiration condition is evaluated
 // using SetCheckExpirationCallback.
-func (cache *Cache) SkipTTLExtensionOnHit(value bool) {
+func (cache *Cache[K, V]) SkipTTLExtensionOnHit(value bool) {
 	cache.mutex.Lock()
 	defer cache.mutex.Unlock()
 	cache.skipTTLExtension = value
@@ -457,69 +892,284 @@ func (cache *Cache) SkipTTLExtensionOnHit(value bool) {
 
 // SetLoaderFunction allows you to set a function to retrieve cache misses. The signature matches that of the Get function.
 // Additional Get calls on the same key block while fetching is in progress (groupcache style).
-func (cache *Cache) SetLoaderFunction(loader LoaderFunction) {
+func (cache *Cache[K, V]) SetLoaderFunction(loader LoaderFunction[K, V]) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.loaderFunction = nil
+	if loader != nil {
+		cache.loaderFunction = withoutContext(loader)
+	}
+}
+
+// SetLoaderFunctionContext is like SetLoaderFunction but the loader receives the context given to GetContext.
+func (cache *Cache[K, V]) SetLoaderFunctionContext(loader LoaderFunctionContext[K, V]) {
 	cache.mutex.Lock()
 	defer cache.mutex.Unlock()
 	cache.loaderFunction = loader
 }
 
 // Purge will remove all entries
-func (cache *Cache) Purge() error {
+func (cache *Cache[K, V]) Purge() error {
 	cache.mutex.Lock()
 	defer cache.mutex.Unlock()
+	cache.purge()
+	return cache.logPurge()
+}
+
+// purge removes all entries without calling the callbacks
+func (cache *Cache[K, V]) purge() {
 	cache.metrics.EvictedClosed += int64(len(cache.items))
-	cache.items = make(map[string]*item)
-	cache.expirationHeap = NewExpirationHeap()
-	return nil
+	for _, item := range cache.items {
+		cache.publish(EventRemoved, item, Closed)
+	}
+	cache.items = make(map[K]*item[K, V])
+	cache.expirationQueue = cache.startExpirationQueue(cache.newExpirationQueue)
+	cache.tags = make(map[string]map[K]struct{})
+	if cache.keyIndex != nil {
+		cache.keyIndex = &radixTree[K]{}
+	}
+	cache.totalCost = 0
+	if cache.evictionPolicy != nil {
+		cache.evictionPolicy.Purge()
+	}
 }
 
 // SetCacheSizeLimit sets a limit to the amount of cached items.
-// If a new item is getting cached, the closes item to being timed out will be replaced
-// Set to 0 to turn off
-func (cache *Cache) SetCacheSizeLimit(limit int) {
+// If a new item is getting cached, the item chosen by the eviction policy will be replaced,
+// by default the closest item to being timed out. Set to 0 to turn off
+func (cache *Cache[K, V]) SetCacheSizeLimit(limit int) {
 	cache.mutex.Lock()
 	defer cache.mutex.Unlock()
 	cache.sizeLimit = limit
 }
 
-// NewCache is a helper to create instance of the Cache struct
-func NewCache() *Cache {
+// GetCacheSizeLimit returns the limit to the amount of cached items, 0 when there is no limit
+func (cache *Cache[K, V]) GetCacheSizeLimit() int {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return cache.sizeLimit
+}
+
+// SetStaleWhileRevalidate keeps items in the cache for the given window once their TTL is over. A stale item is
+// returned right away by Get while the loader function refreshes it in the background, the stale value is kept
+// when the loader fails. Set to 0 to turn off, the window only applies to items set afterwards.
+func (cache *Cache[K, V]) SetStaleWhileRevalidate(window time.Duration) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.staleTTL = window
+}
+
+// SetRefreshAhead makes the loader function refresh items once the given fraction of their TTL is over,
+// for example 0.8, instead of waiting for them to expire. The value is replaced in place when the loader succeeds,
+// the current value is kept until it expires otherwise, see SetRefreshErrorCallback. The fraction applies to
+// items added afterwards. Set to 0 to turn off. Note that extending the TTL on hit also postpones the refresh.
+func (cache *Cache[K, V]) SetRefreshAhead(fraction float64) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.refreshAhead = validRefreshAhead(fraction)
+}
+
+// SetWithRefreshAhead is like SetWithTTL but the item is refreshed ahead of its expiration with its own fraction
+// of the TTL, see SetRefreshAhead. The fraction is kept when the item is refreshed or updated.
+func (cache *Cache[K, V]) SetWithRefreshAhead(key K, data V, ttl time.Duration, fraction float64) error {
+	if err := cache.SetWithTTL(key, data, ttl); err != nil {
+		return err
+	}
+	cache.mutex.Lock()
+	if item, exists := cache.items[key]; exists {
+		item.refreshAhead = validRefreshAhead(fraction)
+		item.touch(cache.clock.Now())
+		cache.expirationQueue.Update(item)
+	}
+	cache.mutex.Unlock()
+	cache.notifyExpiration()
+	return nil
+}
+
+// SetRefreshErrorCallback sets a callback that will be called when the loader fails to refresh an item in the background
+func (cache *Cache[K, V]) SetRefreshErrorCallback(callback RefreshErrorCallback[K]) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.refreshErrorCallback = callback
+}
+
+// SetNegativeCaching caches the errors returned by the loader function for the given ttl. Until then, Get returns
+// the cached error for the key without invoking the loader again. The filter decides which errors are cached,
+// for example only a "not found" sentinel, every error is cached when it is nil. Context errors are never cached.
+// Cached errors do not replace items that are still in the cache and they cost 1. Set ttl to 0 to turn off.
+func (cache *Cache[K, V]) SetNegativeCaching(ttl time.Duration, filter func(err error) bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.negativeTTL = ttl
+	cache.negativeFilter = filter
+}
+
+// cacheableError verifies if a loader error has to be cached
+func (cache *Cache[K, V]) cacheableError(err error) bool {
+	if cache.negativeTTL <= 0 || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	return cache.negativeFilter == nil || cache.negativeFilter(err)
+}
+
+// SetMaxCost sets a limit to the total cost of the cached items, the cost of each item is given
+// with SetWithCost or calculated with the Weigher. Without a Weigher every item costs 1.
+// If a new item is getting cached, items chosen by the eviction policy are replaced until it fits.
+// Set to 0 to turn off
+func (cache *Cache[K, V]) SetMaxCost(maxCost int64) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.maxCost = maxCost
+}
+
+// SetWeigher sets a function to calculate the cost of the items added with Set or SetWithTTL.
+// It is called while holding the cache lock, so it must be fast and it can not use the cache.
+func (cache *Cache[K, V]) SetWeigher(weigher Weigher[K, V]) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.weigher = weigher
+}
+
+// SetEvictionPolicy sets the policy used to choose which item is evicted when the cache size limit is reached,
+// see NewLRUPolicy, NewLFUPolicy and NewFIFOPolicy. Items already in the cache are handed over to the new policy.
+// Set to nil to evict the closest item to being timed out.
+func (cache *Cache[K, V]) SetEvictionPolicy(policy EvictionPolicy[K]) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.evictionPolicy = policy
+	if policy != nil {
+		policy.Purge()
+		for key := range cache.items {
+			policy.Add(key)
+		}
+	}
+}
+
+// SetExpirationQueue sets how the items are ordered by expiration time, newQueue is called again by Purge.
+// Use NewTimingWheel for constant time operations with millions of items, at the cost of precision.
+// Set to nil to use an ExpirationHeap, the default. Items already in the cache are moved to the new queue.
+func (cache *Cache[K, V]) SetExpirationQueue(newQueue func() ExpirationQueue) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if newQueue == nil {
+		newQueue = newExpirationHeap
+	}
+	cache.newExpirationQueue = newQueue
+	cache.rebuildExpirationQueue()
+	cache.notifyExpiration()
+}
+
+// rebuildExpirationQueue moves the items to a new expiration queue started at the time of the clock
+func (cache *Cache[K, V]) rebuildExpirationQueue() {
+	queue := cache.startExpirationQueue(cache.newExpirationQueue)
+	for _, item := range cache.items {
+		queue.Add(item)
+	}
+	cache.expirationQueue = queue
+}
+
+// startExpirationQueue creates an expiration queue with newQueue and advances it to the time of the clock,
+// a TimingWheel counts its ticks from there
+func (cache *Cache[K, V]) startExpirationQueue(newQueue func() ExpirationQueue) ExpirationQueue {
+	queue := newQueue()
+	queue.Advance(cache.clock.Now())
+	return queue
+}
+
+// SetClock sets the clock the cache tells the time with, to expire its items and to time its events and records.
+// Set to nil to use the time package, the default. Items already in the cache keep the expiration time they have.
+func (cache *Cache[K, V]) SetClock(clock Clock) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if clock == nil {
+		clock = realClock{}
+	}
+	cache.clock = clock
+	// a TimingWheel counts its ticks from the time of the previous clock
+	cache.rebuildExpirationQueue()
+	cache.expirationNotification.setClock(clock)
+	cache.notifyExpiration()
+}
+
+func newExpirationHeap() ExpirationQueue {
+	return NewExpirationHeap()
+}
+
+// NewCache is a helper to create instance of the Cache struct with the default settings,
+// NewCacheWithOptions configures it before its expiration starts
+func NewCache[K comparable, V any]() *Cache[K, V] {
+	cache := newCache[K, V](newExpirationSignal())
+	cache.expirationNotification.start(cache.clock)
+	go cache.startExpirationProcessing()
+	return cache
+}
+
+// newCache creates a Cache without starting the expiration processing, the notification wakes up
+// the expiration processing whenever it has to recalculate its sleep time.
+func newCache[K comparable, V any](expirationNotification *expirationSignal) *Cache[K, V] {
 
 	shutdownChan := make(chan chan struct{})
 
-	cache := &Cache{
-		items:                  make(map[string]*item),
-		loaderLock:             &singleflight.Group{},
-		expirationHeap:         NewExpirationHeap(),
-		expirationNotification: make(chan bool),
+	return &Cache[K, V]{
+		items:                  make(map[K]*item[K, V]),
+		loaderCalls:            make(map[K]*loaderCall[V]),
+		expirationQueue:        NewExpirationHeap(),
+		newExpirationQueue:     newExpirationHeap,
+		expirationNotification: expirationNotification,
 		expirationTime:         time.Now(),
+		clock:                  realClock{},
 		shutdownSignal:         shutdownChan,
 		isShutDown:             false,
 		loaderFunction:         nil,
 		sizeLimit:              0,
 		metrics:                Metrics{},
+		subscriptions:          make(map[*subscription[K, V]]struct{}),
+		tags:                   make(map[string]map[K]struct{}),
+		loaderLatency:          &latencyHistogram{},
+		getLatency:             &latencyHistogram{},
+		setLatency:             &latencyHistogram{},
 	}
-	go cache.startExpirationProcessing()
-	return cache
 }
 
 // GetMetrics exposes the metrics of the cache. This is a snapshot copy of the metrics.
-func (cache *Cache) GetMetrics() Metrics {
+func (cache *Cache[K, V]) GetMetrics() Metrics {
 	cache.mutex.Lock()
 	defer cache.mutex.Unlock()
-	return cache.metrics
+	metrics := cache.metrics
+	metrics.Cost = cache.totalCost
+	metrics.LoaderLatency = cache.loaderLatency.snapshot()
+	metrics.GetLatency = cache.getLatency.snapshot()
+	metrics.SetLatency = cache.setLatency.snapshot()
+	return metrics
 }
 
-// Touch resets the TTL of the key when it exists, returns ErrNotFound if the key is not present.
-func (cache *Cache) Touch(key string) error {
+// Touch resets the TTL of the key when it exists, returns ErrNotFound if the key is not present
+// and ErrClosed once the cache is closed.
+func (cache *Cache[K, V]) Touch(key K) error {
 	cache.mutex.Lock()
 	defer cache.mutex.Unlock()
+	if cache.isShutDown {
+		return ErrClosed
+	}
 	item, exists := cache.items[key]
 	if !exists {
 		return ErrNotFound
 	}
-	item.touch()
-	return nil
+	item.touch(cache.clock.Now())
+	cache.expirationQueue.Update(item)
+	if cache.evictionPolicy != nil {
+		cache.evictionPolicy.Access(key)
+	}
+	cache.publish(EventTouched, item, 0)
+	return cache.logKey(walTouch, key)
+}
+
+// validRefreshAhead turns off refresh ahead for fractions outside of (0, 1)
+func validRefreshAhead(fraction float64) float64 {
+	if fraction <= 0 || fraction >= 1 {
+		return 0
+	}
+	return fraction
 }
 
 func min(duration time.Duration, second time.Duration) time.Duration {
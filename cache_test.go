@@ -1,8 +1,13 @@
 package ttl_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
 	"math/rand"
 	"strconv"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -12,7 +17,8 @@ import (
 	"fmt"
 	"sync"
 
-	. "github.com/asgarciap/ttl/v3"
+	. "github.com/asgarciap/ttl/v4"
+	"github.com/asgarciap/ttl/v4/ttltest"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -23,7 +29,7 @@ func TestMain(m *testing.M) {
 // The SimpleCache interface enables quick-start.
 func TestCache_SimpleCache(t *testing.T) {
 	t.Parallel()
-	var cache SimpleCache = NewCache()
+	var cache SimpleCache[string, interface{}] = NewCache[string, interface{}]()
 
 	var er error
 	er = cache.SetTTL(time.Second)
@@ -42,7 +48,7 @@ func TestCache_SimpleCache(t *testing.T) {
 func TestCache_GetByLoaderRace(t *testing.T) {
 	t.Skip()
 	t.Parallel()
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 	er := cache.SetTTL(time.Microsecond)
 	assert.Nil(t, er)
 	defer cache.Close()
@@ -84,7 +90,7 @@ func TestCache_GetByLoaderRace(t *testing.T) {
 // This is facilitated by supplying a loder function with Get's.
 func TestCache_GetByLoader(t *testing.T) {
 	t.Parallel()
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 	defer cache.Close()
 
 	globalLoader := func(key string) (data interface{}, ttl time.Duration, err error) {
@@ -120,7 +126,7 @@ func TestCache_GetByLoader(t *testing.T) {
 // Issue #38: Feature request: ability to know why an expiry has occurred
 func TestCache_textExpirationReasons(t *testing.T) {
 	t.Parallel()
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 
 	var reason EvictionReason
 	var sync = make(chan struct{})
@@ -156,7 +162,7 @@ func TestCache_textExpirationReasons(t *testing.T) {
 
 func TestCache_TestTouch(t *testing.T) {
 	t.Parallel()
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 	defer cache.Close()
 
 	lock := sync.Mutex{}
@@ -200,7 +206,7 @@ func TestCache_TestTouch(t *testing.T) {
 // Issue #37: Cache metrics
 func TestCache_TestMetrics(t *testing.T) {
 	t.Parallel()
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 	defer cache.Close()
 
 	cache.SetTTL(time.Second)
@@ -227,12 +233,16 @@ func TestCache_TestMetrics(t *testing.T) {
 	metrics = cache.GetMetrics()
 	assert.Equal(t, int64(2), metrics.EvictedExpired)
 
+	cache.Set("5", "5")
+	cache.Remove("5")
+	metrics = cache.GetMetrics()
+	assert.Equal(t, int64(1), metrics.Removed)
 }
 
 // Issue #31: Test that a single fetch is executed with the loader function
 func TestCache_TestSingleFetch(t *testing.T) {
 	t.Parallel()
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 	defer cache.Close()
 
 	var calls int32
@@ -262,7 +272,7 @@ func TestCache_TestSingleFetch(t *testing.T) {
 // Issue #30: Removal does not use expiration callback.
 func TestCache_TestRemovalTriggersCallback(t *testing.T) {
 	t.Parallel()
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 	defer cache.Close()
 
 	var sync = make(chan struct{})
@@ -281,7 +291,7 @@ func TestCache_TestRemovalTriggersCallback(t *testing.T) {
 // Issue #31: loader function
 func TestCache_TestLoaderFunction(t *testing.T) {
 	t.Parallel()
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 
 	cache.SetLoaderFunction(func(key string) (data interface{}, ttl time.Duration, err error) {
 		return nil, 0, ErrNotFound
@@ -308,7 +318,7 @@ func TestCache_TestLoaderFunction(t *testing.T) {
 // Issue #31: edge case where cache is closed when loader function has completed
 func TestCache_TestLoaderFunctionDuringClose(t *testing.T) {
 	t.Parallel()
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 
 	cache.SetLoaderFunction(func(key string) (data interface{}, ttl time.Duration, err error) {
 		cache.Close()
@@ -326,7 +336,7 @@ func TestCache_TestLoaderFunctionDuringClose(t *testing.T) {
 // Cache sometimes returns key not found under parallel access with a loader function
 func TestCache_TestLoaderFunctionParallelKeyAccess(t *testing.T) {
 	t.Parallel()
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 
 	cache.SetLoaderFunction(func(key string) (data interface{}, ttl time.Duration, err error) {
 		time.Sleep(time.Millisecond * 300)
@@ -357,7 +367,7 @@ func TestCache_TestLoaderFunctionParallelKeyAccess(t *testing.T) {
 // Issue #28: call expirationCallback automatically on cache.Close()
 func TestCache_ExpirationOnClose(t *testing.T) {
 	t.Parallel()
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 
 	success := make(chan struct{})
 	defer close(success)
@@ -389,7 +399,7 @@ func TestCache_ExpirationOnClose(t *testing.T) {
 
 func TestCache_ModifyAfterClose(t *testing.T) {
 	t.Parallel()
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 
 	cache.SetTTL(time.Hour * 100)
 	cache.SetExpirationCallback(func(key string, value interface{}) {
@@ -423,7 +433,7 @@ func TestCache_ModifyAfterClose(t *testing.T) {
 // that it can be called in a repeated way without problems.
 func TestCache_MultipleCloseCalls(t *testing.T) {
 	t.Parallel()
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 
 	cache.SetTTL(time.Millisecond * 100)
 
@@ -446,7 +456,7 @@ func TestCache_MultipleCloseCalls(t *testing.T) {
 func TestCache_SkipTtlExtensionOnHit(t *testing.T) {
 	t.Parallel()
 
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 	defer cache.Close()
 
 	cache.SetTTL(time.Millisecond * 100)
@@ -471,7 +481,7 @@ func TestCache_SkipTtlExtensionOnHit(t *testing.T) {
 func TestCache_ForRacesAcrossGoroutines(t *testing.T) {
 	t.Parallel()
 
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 	defer cache.Close()
 
 	cache.SetTTL(time.Minute * 1)
@@ -517,7 +527,7 @@ func TestCache_ForRacesAcrossGoroutines(t *testing.T) {
 }
 
 func TestCache_SkipTtlExtensionOnHit_ForRacesAcrossGoroutines(t *testing.T) {
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 	defer cache.Close()
 
 	cache.SetTTL(time.Minute * 1)
@@ -570,7 +580,7 @@ func TestCache_SetCheckExpirationCallback(t *testing.T) {
 	iterated := 0
 	ch := make(chan struct{})
 
-	cacheAD := NewCache()
+	cacheAD := NewCache[string, interface{}]()
 	defer cacheAD.Close()
 
 	cacheAD.SetTTL(time.Millisecond)
@@ -604,7 +614,7 @@ func TestCache_SetExpirationCallback(t *testing.T) {
 	}
 
 	// Setup the TTL cache
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 	defer cache.Close()
 
 	ch := make(chan struct{}, 1024)
@@ -634,7 +644,7 @@ func TestCache_SetExpirationCallback(t *testing.T) {
 func TestRemovalAndCountDoesNotPanic(t *testing.T) {
 	t.Parallel()
 
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 	defer cache.Close()
 
 	cache.Set("key", "value")
@@ -647,7 +657,7 @@ func TestRemovalAndCountDoesNotPanic(t *testing.T) {
 func TestRemovalWithTtlDoesNotPanic(t *testing.T) {
 	t.Parallel()
 
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 	defer cache.Close()
 
 	cache.SetExpirationCallback(func(key string, value interface{}) {
@@ -680,7 +690,7 @@ func TestRemovalWithTtlDoesNotPanic(t *testing.T) {
 func TestCacheIndividualExpirationBiggerThanGlobal(t *testing.T) {
 	t.Parallel()
 
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 	defer cache.Close()
 
 	cache.SetTTL(time.Duration(50 * time.Millisecond))
@@ -694,7 +704,7 @@ func TestCacheIndividualExpirationBiggerThanGlobal(t *testing.T) {
 func TestCacheGlobalExpirationByGlobal(t *testing.T) {
 	t.Parallel()
 
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 	defer cache.Close()
 
 	cache.Set("key", "value")
@@ -717,7 +727,7 @@ func TestCacheGlobalExpirationByGlobal(t *testing.T) {
 func TestCacheGlobalExpiration(t *testing.T) {
 	t.Parallel()
 
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 	defer cache.Close()
 
 	cache.SetTTL(time.Duration(100 * time.Millisecond))
@@ -731,7 +741,7 @@ func TestCacheGlobalExpiration(t *testing.T) {
 func TestCacheMixedExpirations(t *testing.T) {
 	t.Parallel()
 
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 	defer cache.Close()
 
 	cache.SetExpirationCallback(func(key string, value interface{}) {
@@ -747,7 +757,7 @@ func TestCacheMixedExpirations(t *testing.T) {
 func TestCacheIndividualExpiration(t *testing.T) {
 	t.Parallel()
 
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 	defer cache.Close()
 
 	cache.SetWithTTL("key", "value", time.Duration(100*time.Millisecond))
@@ -767,7 +777,7 @@ func TestCacheIndividualExpiration(t *testing.T) {
 func TestCacheGet(t *testing.T) {
 	t.Parallel()
 
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 	defer cache.Close()
 
 	data, exists := cache.Get("hello")
@@ -784,7 +794,7 @@ func TestCacheGet(t *testing.T) {
 func TestCacheGetWithTTL(t *testing.T) {
 	t.Parallel()
 
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 	defer cache.Close()
 
 	data, ttl, exists := cache.GetWithTTL("hello")
@@ -812,7 +822,7 @@ func TestCacheGetWithTTL(t *testing.T) {
 
 func TestCache_TestGetWithTTLAndLoaderFunction(t *testing.T) {
 	t.Parallel()
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 
 	cache.SetLoaderFunction(func(key string) (data interface{}, ttl time.Duration, err error) {
 		return nil, 0, ErrNotFound
@@ -842,7 +852,7 @@ func TestCache_TestGetWithTTLAndLoaderFunction(t *testing.T) {
 func TestCacheGetKeys(t *testing.T) {
 	t.Parallel()
 
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 
 	keys := cache.GetKeys()
 	assert.Empty(t, keys, "Expected keys to be empty")
@@ -862,7 +872,7 @@ func TestCacheExpirationCallbackFunction(t *testing.T) {
 	expiredCount := 0
 	var lock sync.Mutex
 
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 	defer cache.Close()
 
 	cache.SetTTL(time.Duration(500 * time.Millisecond))
@@ -888,7 +898,7 @@ func TestCacheCheckExpirationCallbackFunction(t *testing.T) {
 	expiredCount := 0
 	var lock sync.Mutex
 
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 	defer cache.Close()
 
 	cache.SkipTTLExtensionOnHit(true)
@@ -919,7 +929,7 @@ func TestCacheNewItemCallbackFunction(t *testing.T) {
 	t.Parallel()
 
 	newItemCount := 0
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 	defer cache.Close()
 
 	cache.SetTTL(time.Duration(50 * time.Millisecond))
@@ -936,7 +946,7 @@ func TestCacheNewItemCallbackFunction(t *testing.T) {
 func TestCacheRemove(t *testing.T) {
 	t.Parallel()
 
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 	defer cache.Close()
 	cache.SetTTL(time.Duration(50 * time.Millisecond))
 	cache.SetWithTTL("key", "value", time.Duration(100*time.Millisecond))
@@ -951,7 +961,7 @@ func TestCacheRemove(t *testing.T) {
 func TestCacheSetWithTTLExistItem(t *testing.T) {
 	t.Parallel()
 
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 	defer cache.Close()
 
 	cache.SetTTL(time.Duration(100 * time.Millisecond))
@@ -966,7 +976,7 @@ func TestCacheSetWithTTLExistItem(t *testing.T) {
 func TestCache_Purge(t *testing.T) {
 	t.Parallel()
 
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 	defer cache.Close()
 
 	cache.SetTTL(time.Duration(100 * time.Millisecond))
@@ -987,7 +997,7 @@ func TestCache_Purge(t *testing.T) {
 func TestCache_Limit(t *testing.T) {
 	t.Parallel()
 
-	cache := NewCache()
+	cache := NewCache[string, interface{}]()
 	defer cache.Close()
 
 	cache.SetTTL(time.Duration(100 * time.Second))
@@ -1003,3 +1013,1780 @@ func TestCache_Limit(t *testing.T) {
 		assert.Equal(t, "value", val, "Cache should be set [key90, key99]")
 	}
 }
+
+// Generic caches return typed values and accept any comparable key.
+func TestCache_TypedKeysAndValues(t *testing.T) {
+	t.Parallel()
+
+	type userKey struct {
+		tenant string
+		name   string
+	}
+	type user struct {
+		name string
+	}
+
+	cache := NewCache[userKey, *user]()
+	defer cache.Close()
+
+	var loads int32
+	cache.SetLoaderFunction(func(key userKey) (*user, time.Duration, error) {
+		atomic.AddInt32(&loads, 1)
+		return &user{name: key.name}, 0, nil
+	})
+
+	data, err := cache.Get(userKey{tenant: "a b", name: ""})
+	assert.Nil(t, err)
+	assert.Equal(t, "", data.name)
+
+	// both keys format as "{a b }" with %v, they must not share a loader call
+	data, err = cache.Get(userKey{tenant: "a", name: "b "})
+	assert.Nil(t, err)
+	assert.Equal(t, "b ", data.name)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&loads))
+
+	assert.Nil(t, cache.Set(userKey{tenant: "1"}, &user{name: "set"}))
+	data, err = cache.Get(userKey{tenant: "1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "set", data.name)
+	assert.Equal(t, 3, cache.Count())
+
+	assert.Nil(t, cache.Remove(userKey{tenant: "1"}))
+	cache.SetLoaderFunction(nil)
+	data, err = cache.Get(userKey{tenant: "1"})
+	assert.Equal(t, ErrNotFound, err)
+	assert.Nil(t, data)
+}
+
+func TestCache_LoaderCallsPerKey(t *testing.T) {
+	t.Parallel()
+
+	type user struct {
+		name string
+	}
+	cache := NewCache[*user, *user]()
+	defer cache.Close()
+
+	var loads int32
+	release := make(chan struct{})
+	cache.SetLoaderFunction(func(key *user) (*user, time.Duration, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return key, 0, nil
+	})
+
+	// both keys format as &{name:"a"} with %#v, they must not share a loader call
+	keys := []*user{{name: "a"}, {name: "a"}}
+	var wg sync.WaitGroup
+	for _, key := range keys {
+		wg.Add(1)
+		go func(key *user) {
+			defer wg.Done()
+			data, err := cache.Get(key)
+			assert.Nil(t, err)
+			assert.Same(t, key, data)
+		}(key)
+	}
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&loads) == 2
+	}, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int64(0), cache.GetMetrics().LoaderDeduplicated)
+}
+
+func TestCache_EvictionPolicy(t *testing.T) {
+	t.Parallel()
+
+	cache := NewCache[string, interface{}]()
+	defer cache.Close()
+
+	evicted := make(chan string, 10)
+	cache.SetExpirationReasonCallback(func(key string, reason EvictionReason, value interface{}) {
+		if reason == EvictedSize {
+			evicted <- key
+		}
+	})
+	cache.SetCacheSizeLimit(3)
+	cache.SetEvictionPolicy(NewLRUPolicy[string]())
+
+	// items that never expire are still chosen by the policy
+	cache.SetWithTTL("a", 1, ItemNotExpire)
+	cache.SetWithTTL("b", 2, time.Hour)
+	cache.SetWithTTL("c", 3, time.Minute)
+	cache.Get("a")
+	cache.Set("d", 4)
+	assert.Equal(t, "b", <-evicted)
+
+	cache.Touch("c")
+	cache.Set("e", 5)
+	assert.Equal(t, "a", <-evicted)
+
+	cache.Remove("d")
+	cache.Set("f", 6)
+	cache.Set("g", 7)
+	assert.Equal(t, "c", <-evicted)
+	assert.Equal(t, 3, cache.Count())
+	assert.Equal(t, int64(3), cache.GetMetrics().EvictedFull)
+
+	cache.Purge()
+	cache.SetEvictionPolicy(NewFIFOPolicy[string]())
+	cache.Set("h", 8)
+	cache.Set("i", 9)
+	cache.Set("j", 10)
+	cache.Get("h")
+	cache.Set("k", 11)
+	assert.Equal(t, "h", <-evicted)
+}
+
+func TestCache_MaxCost(t *testing.T) {
+	t.Parallel()
+
+	cache := NewCache[string, string]()
+	defer cache.Close()
+
+	evicted := make(chan string, 10)
+	cache.SetExpirationReasonCallback(func(key string, reason EvictionReason, value string) {
+		if reason == EvictedSize {
+			evicted <- key
+		}
+	})
+	cache.SetMaxCost(10)
+	cache.SetEvictionPolicy(NewFIFOPolicy[string]())
+	cache.SetWeigher(func(key string, value string) int64 {
+		return int64(len(value))
+	})
+
+	assert.Nil(t, cache.Set("a", "aaa"))
+	assert.Nil(t, cache.Set("b", "bbb"))
+	assert.Nil(t, cache.SetWithCost("c", "c", time.Hour, 3))
+	assert.Equal(t, int64(9), cache.GetMetrics().Cost)
+
+	// as many items as needed are evicted
+	assert.Nil(t, cache.Set("d", "dddddd"))
+	// callbacks run on their own goroutines, so the order is not known
+	assert.ElementsMatch(t, []string{"a", "b"}, []string{<-evicted, <-evicted})
+	assert.Equal(t, 2, cache.Count())
+	assert.Equal(t, int64(9), cache.GetMetrics().Cost)
+
+	// an update never evicts the item itself
+	assert.Nil(t, cache.Set("d", "dddddddd"))
+	assert.Equal(t, "c", <-evicted)
+	assert.Equal(t, int64(8), cache.GetMetrics().Cost)
+	data, err := cache.Get("d")
+	assert.Nil(t, err)
+	assert.Equal(t, "dddddddd", data)
+
+	assert.Equal(t, ErrCostExceeded, cache.Set("e", "eeeeeeeeeee"))
+	assert.Nil(t, cache.Remove("d"))
+	assert.Equal(t, int64(0), cache.GetMetrics().Cost)
+
+	cache.SetWeigher(nil)
+	assert.Nil(t, cache.Set("f", "ffff"))
+	assert.Equal(t, int64(1), cache.GetMetrics().Cost)
+	cache.Purge()
+	assert.Equal(t, int64(0), cache.GetMetrics().Cost)
+	assert.Equal(t, int64(3), cache.GetMetrics().EvictedFull)
+}
+
+func TestCache_MaxCostExpiredItems(t *testing.T) {
+	t.Parallel()
+
+	cache := NewCache[string, string]()
+	defer cache.Close()
+	cache.SetMaxCost(10)
+
+	assert.Nil(t, cache.SetWithCost("a", "a", time.Millisecond, 5))
+	assert.Nil(t, cache.SetWithCost("b", "b", time.Hour, 5))
+	time.Sleep(10 * time.Millisecond)
+	// the expired item is replaced, whether or not the expiration job got to it
+	assert.Nil(t, cache.SetWithCost("a", "a2", time.Hour, 5))
+	assert.Equal(t, 2, cache.Count())
+	assert.Equal(t, int64(10), cache.GetMetrics().Cost)
+}
+
+type contextKey string
+
+func TestCache_GetContext(t *testing.T) {
+	t.Parallel()
+	cache := NewCache[string, string]()
+	defer cache.Close()
+
+	cache.SetLoaderFunctionContext(func(ctx context.Context, key string) (string, time.Duration, error) {
+		traceID, _ := ctx.Value(contextKey("trace")).(string)
+		return key + " " + traceID, 0, nil
+	})
+
+	ctx := context.WithValue(context.Background(), contextKey("trace"), "42")
+	data, err := cache.GetContext(ctx, "a")
+	assert.Nil(t, err)
+	assert.Equal(t, "a 42", data)
+
+	// a plain Get does not carry any value
+	data, err = cache.Get("b")
+	assert.Nil(t, err)
+	assert.Equal(t, "b ", data)
+
+	data, _, err = cache.GetByLoaderContext(ctx, "c", func(ctx context.Context, key string) (string, time.Duration, error) {
+		return "custom", 0, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "custom", data)
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	data, err = cache.GetContext(cancelled, "d")
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, "", data)
+	// cached items are returned regardless of the context
+	data, err = cache.GetContext(cancelled, "a")
+	assert.Nil(t, err)
+	assert.Equal(t, "a 42", data)
+}
+
+func TestCache_GetContextCancellation(t *testing.T) {
+	t.Parallel()
+	cache := NewCache[string, string]()
+	defer cache.Close()
+
+	started := make(chan struct{}, 2)
+	loadCancelled := make(chan struct{})
+	cache.SetLoaderFunctionContext(func(ctx context.Context, key string) (string, time.Duration, error) {
+		started <- struct{}{}
+		if key == "slow" {
+			<-ctx.Done()
+			close(loadCancelled)
+			return "", 0, ctx.Err()
+		}
+		return "fast", 0, nil
+	})
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel2()
+
+	errs := make(chan error, 2)
+	go func() {
+		_, err := cache.GetContext(ctx1, "slow")
+		errs <- err
+	}()
+	<-started
+	go func() {
+		_, err := cache.GetContext(ctx2, "slow")
+		errs <- err
+	}()
+
+	// the first caller leaves, the load keeps going for the second one
+	time.Sleep(10 * time.Millisecond)
+	cancel1()
+	assert.Equal(t, context.Canceled, <-errs)
+	select {
+	case <-loadCancelled:
+		t.Fatal("Expected the load to continue while a caller is waiting")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// the deadline of the last caller cancels the load
+	assert.Equal(t, context.DeadlineExceeded, <-errs)
+	<-loadCancelled
+	assert.Equal(t, 0, len(started), "Expected a single load for both callers")
+
+	// an abandoned load is not joined by new callers
+	cache.SetLoaderFunctionContext(func(ctx context.Context, key string) (string, time.Duration, error) {
+		return "reloaded", 0, nil
+	})
+	data, err := cache.GetContext(context.Background(), "slow")
+	assert.Nil(t, err)
+	assert.Equal(t, "reloaded", data)
+}
+
+func TestCache_StaleWhileRevalidate(t *testing.T) {
+	t.Parallel()
+	cache := NewCache[string, string]()
+	defer cache.Close()
+
+	var loads int32
+	release := make(chan struct{})
+	cache.SetLoaderFunction(func(key string) (string, time.Duration, error) {
+		<-release
+		if atomic.AddInt32(&loads, 1) == 1 {
+			return "", 0, ErrNotFound
+		}
+		return "fresh", 0, nil
+	})
+	cache.SetStaleWhileRevalidate(time.Hour)
+	cache.SetWithTTL("key", "stale", 20*time.Millisecond)
+	<-time.After(40 * time.Millisecond)
+
+	// stale values are returned right away while a single refresh runs
+	for i := 0; i < 10; i++ {
+		data, ttl, err := cache.GetWithTTL("key")
+		assert.Nil(t, err)
+		assert.Equal(t, "stale", data)
+		assert.Equal(t, time.Duration(0), ttl)
+	}
+	close(release)
+	assert.Eventually(t, func() bool {
+		return cache.GetMetrics().RefreshFailed == 1
+	}, time.Second, time.Millisecond)
+
+	// the failed refresh kept the stale value, the next one replaces it
+	data, err := cache.Get("key")
+	assert.Nil(t, err)
+	assert.Equal(t, "stale", data)
+	assert.Eventually(t, func() bool {
+		return cache.GetMetrics().Refreshed == 1
+	}, time.Second, time.Millisecond)
+	data, err = cache.Get("key")
+	assert.Nil(t, err)
+	assert.Equal(t, "fresh", data)
+
+	metrics := cache.GetMetrics()
+	assert.Equal(t, int64(11), metrics.StaleRetrievals)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&loads))
+}
+
+func TestCache_StaleWindowExpiration(t *testing.T) {
+	t.Parallel()
+	cache := NewCache[string, string]()
+	defer cache.Close()
+
+	cache.SetStaleWhileRevalidate(50 * time.Millisecond)
+	cache.SetWithTTL("key", "value", 20*time.Millisecond)
+	<-time.After(40 * time.Millisecond)
+	// without a loader stale items are still served until the window is over
+	data, err := cache.Get("key")
+	assert.Nil(t, err)
+	assert.Equal(t, "value", data)
+	<-time.After(60 * time.Millisecond)
+	_, err = cache.Get("key")
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, 0, cache.Count())
+	assert.Equal(t, int64(1), cache.GetMetrics().EvictedExpired)
+}
+
+func TestCache_RefreshAhead(t *testing.T) {
+	t.Parallel()
+	cache := NewCache[string, int]()
+	defer cache.Close()
+
+	var loads int32
+	cache.SetLoaderFunction(func(key string) (int, time.Duration, error) {
+		return int(atomic.AddInt32(&loads, 1)), 100 * time.Millisecond, nil
+	})
+	cache.SkipTTLExtensionOnHit(true)
+	cache.SetRefreshAhead(0.5)
+
+	data, err := cache.Get("config")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, data)
+
+	// the item is refreshed in place before it expires, callers never miss
+	for i := 0; i < 25; i++ {
+		<-time.After(10 * time.Millisecond)
+		_, err = cache.Get("config")
+		assert.Nil(t, err)
+	}
+	assert.GreaterOrEqual(t, atomic.LoadInt32(&loads), int32(4))
+	metrics := cache.GetMetrics()
+	assert.Equal(t, int64(1), metrics.Misses)
+	assert.Equal(t, int64(0), metrics.EvictedExpired)
+	assert.Equal(t, int64(atomic.LoadInt32(&loads)-1), metrics.Refreshed)
+	cache.SetLoaderFunction(nil)
+	<-time.After(20 * time.Millisecond)
+}
+
+func TestCache_RefreshAheadFailure(t *testing.T) {
+	t.Parallel()
+	cache := NewCache[string, string]()
+	defer cache.Close()
+
+	failures := make(chan error, 10)
+	cache.SetRefreshErrorCallback(func(key string, err error) {
+		failures <- err
+	})
+	cache.SetLoaderFunction(func(key string) (string, time.Duration, error) {
+		return "", 0, ErrNotFound
+	})
+	cache.SkipTTLExtensionOnHit(true)
+	// the item fraction wins over the cache one
+	cache.SetRefreshAhead(0.9)
+	assert.Nil(t, cache.SetWithRefreshAhead("key", "old", 100*time.Millisecond, 0.2))
+
+	select {
+	case err := <-failures:
+		assert.Equal(t, ErrNotFound, err)
+	case <-time.After(50 * time.Millisecond):
+		t.Fatal("Expected the item to be refreshed at 20% of its TTL")
+	}
+	// the old value stays until the item really expires
+	data, err := cache.Get("key")
+	assert.Nil(t, err)
+	assert.Equal(t, "old", data)
+	assert.Equal(t, int64(1), cache.GetMetrics().RefreshFailed)
+
+	<-time.After(120 * time.Millisecond)
+	_, err = cache.Get("key")
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, int64(1), cache.GetMetrics().EvictedExpired)
+}
+
+func TestCache_NegativeCaching(t *testing.T) {
+	t.Parallel()
+	cache := NewCache[string, string]()
+	defer cache.Close()
+
+	errUnknownUser := fmt.Errorf("unknown user")
+	errTimeout := fmt.Errorf("timeout")
+	var loads int32
+	cache.SetLoaderFunction(func(key string) (string, time.Duration, error) {
+		atomic.AddInt32(&loads, 1)
+		if key == "flaky" {
+			return "", 0, errTimeout
+		}
+		return "", 0, errUnknownUser
+	})
+	reasons := make(chan EvictionReason, 10)
+	cache.SetExpirationReasonCallback(func(key string, reason EvictionReason, value string) {
+		reasons <- reason
+	})
+	cache.SetNegativeCaching(50*time.Millisecond, func(err error) bool {
+		return err == errUnknownUser
+	})
+
+	for i := 0; i < 5; i++ {
+		_, err := cache.Get("42")
+		assert.Equal(t, errUnknownUser, err)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads), "Expected the error to be cached")
+
+	// errors rejected by the filter are not cached
+	cache.Get("flaky")
+	cache.Get("flaky")
+	assert.Equal(t, int32(3), atomic.LoadInt32(&loads))
+
+	metrics := cache.GetMetrics()
+	assert.Equal(t, int64(1), metrics.NegativeInserted)
+	assert.Equal(t, int64(4), metrics.NegativeHits)
+	assert.Equal(t, int64(0), metrics.Inserted)
+
+	assert.Equal(t, ExpiredNegative, <-reasons)
+	assert.Equal(t, int64(1), cache.GetMetrics().EvictedNegative)
+	_, err := cache.Get("42")
+	assert.Equal(t, errUnknownUser, err)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&loads), "Expected the loader to be invoked after expiration")
+
+	// a value replaces the cached error
+	assert.Nil(t, cache.Set("42", "found"))
+	data, err := cache.Get("42")
+	assert.Nil(t, err)
+	assert.Equal(t, "found", data)
+}
+
+func TestCache_NegativeCachingCallbacks(t *testing.T) {
+	t.Parallel()
+	cache := NewCache[string, string]()
+	defer cache.Close()
+
+	var loads int32
+	cache.SetLoaderFunction(func(key string) (string, time.Duration, error) {
+		atomic.AddInt32(&loads, 1)
+		return "", 0, ErrNotFound
+	})
+	cache.SetNegativeCaching(10*time.Millisecond, nil)
+	var expired, checked int32
+	cache.SetExpirationCallback(func(key string, value string) {
+		atomic.AddInt32(&expired, 1)
+	})
+	cache.SetCheckExpirationCallback(func(key string, value string) bool {
+		atomic.AddInt32(&checked, 1)
+		return false
+	})
+	reasons := make(chan EvictionReason, 10)
+	cache.SetExpirationReasonCallback(func(key string, reason EvictionReason, value string) {
+		reasons <- reason
+	})
+
+	_, err := cache.Get("42")
+	assert.Equal(t, ErrNotFound, err)
+	// the check callback can not keep the error alive
+	assert.Equal(t, ExpiredNegative, <-reasons)
+	_, err = cache.Get("42")
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&loads))
+
+	// a removed error is not reported
+	err = cache.Remove("42")
+	assert.Nil(t, err)
+	<-time.After(20 * time.Millisecond)
+	assert.Equal(t, 0, len(reasons))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&expired))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&checked))
+}
+
+func TestCache_NegativeCachingKeepsValues(t *testing.T) {
+	t.Parallel()
+	cache := NewCache[string, string]()
+	defer cache.Close()
+
+	cache.SetNegativeCaching(time.Minute, nil)
+	cache.SetStaleWhileRevalidate(time.Minute)
+	cache.SetLoaderFunction(func(key string) (string, time.Duration, error) {
+		return "", 0, ErrNotFound
+	})
+	cache.SetWithTTL("key", "stale", time.Millisecond)
+	<-time.After(5 * time.Millisecond)
+
+	// a failed refresh keeps the stale value instead of caching the error
+	data, err := cache.Get("key")
+	assert.Nil(t, err)
+	assert.Equal(t, "stale", data)
+	assert.Eventually(t, func() bool {
+		return cache.GetMetrics().RefreshFailed == 1
+	}, time.Second, time.Millisecond)
+	data, err = cache.Get("key")
+	assert.Nil(t, err)
+	assert.Equal(t, "stale", data)
+	assert.Equal(t, int64(0), cache.GetMetrics().NegativeInserted)
+
+	// context errors are never cached
+	cache.SetLoaderFunctionContext(func(ctx context.Context, key string) (string, time.Duration, error) {
+		return "", 0, context.DeadlineExceeded
+	})
+	_, err = cache.Get("other")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, int64(0), cache.GetMetrics().NegativeInserted)
+}
+
+// intCodec encodes int keys as decimal strings
+type intCodec struct{}
+
+func (intCodec) Encode(value int) ([]byte, error) {
+	return []byte(strconv.Itoa(value)), nil
+}
+
+func (intCodec) Decode(data []byte) (int, error) {
+	return strconv.Atoi(string(data))
+}
+
+func TestCache_SaveLoad(t *testing.T) {
+	t.Parallel()
+	cache := NewCache[string, interface{}]()
+	defer cache.Close()
+
+	cache.SetTTL(time.Hour)
+	cache.Set("global", "a")
+	cache.SetWithTTL("forever", 42, ItemNotExpire)
+	cache.SetWithTTL("short", "b", 10*time.Millisecond)
+	cache.SetWithTTL("medium", "c", 200*time.Millisecond)
+
+	var buffer bytes.Buffer
+	assert.Nil(t, cache.Save(&buffer))
+	<-time.After(20 * time.Millisecond)
+
+	// Close expires the remaining items as well
+	expired := make(chan string, 3)
+	restored := NewCache[string, interface{}]()
+	defer restored.Close()
+	restored.SetExpirationCallback(func(key string, value interface{}) {
+		expired <- key
+	})
+	assert.Nil(t, restored.Load(&buffer))
+	assert.ElementsMatch(t, []string{"global", "forever", "medium"}, restored.GetKeys())
+
+	data, ttl, err := restored.GetWithTTL("global")
+	assert.Nil(t, err)
+	assert.Equal(t, "a", data)
+	assert.Greater(t, ttl, 59*time.Minute)
+	data, err = restored.Get("forever")
+	assert.Nil(t, err)
+	assert.Equal(t, 42, data)
+
+	// the remaining lifetime is kept, not the full ttl
+	restored.SkipTTLExtensionOnHit(true)
+	data, ttl, err = restored.GetWithTTL("medium")
+	assert.Nil(t, err)
+	assert.Equal(t, "c", data)
+	assert.LessOrEqual(t, ttl, 180*time.Millisecond)
+	select {
+	case key := <-expired:
+		assert.Equal(t, "medium", key)
+	case <-time.After(190 * time.Millisecond):
+		t.Fatal("restored item did not expire in time")
+	}
+}
+
+func TestCache_SaveLoadCodec(t *testing.T) {
+	t.Parallel()
+	cache := NewShardedCache[int, string](4)
+	defer cache.Close()
+	cache.SetCodec(intCodec{}, nil)
+
+	for i := 0; i < 100; i++ {
+		cache.SetWithCost(i, strconv.Itoa(i), ItemNotExpire, 2)
+	}
+	var buffer bytes.Buffer
+	assert.Nil(t, cache.Save(&buffer))
+	assert.True(t, bytes.Contains(buffer.Bytes(), []byte("99")))
+
+	restored := NewCache[int, string]()
+	defer restored.Close()
+	restored.SetCodec(intCodec{}, GobCodec[string]{})
+	restored.SetMaxCost(100)
+	assert.Nil(t, restored.Load(&buffer))
+	assert.Equal(t, 50, restored.Count())
+	assert.Equal(t, int64(100), restored.GetMetrics().Cost)
+}
+
+func TestCache_LoadInvalidSnapshot(t *testing.T) {
+	t.Parallel()
+	cache := NewCache[string, string]()
+	defer cache.Close()
+
+	assert.Equal(t, ErrInvalidSnapshot, cache.Load(strings.NewReader("not a snapshot")))
+
+	source := NewCache[string, string]()
+	defer source.Close()
+	source.Set("a", "1")
+	source.Set("b", "2")
+	var buffer bytes.Buffer
+	assert.Nil(t, source.Save(&buffer))
+
+	// nothing is added when the snapshot is truncated
+	truncated := bytes.NewReader(buffer.Bytes()[:buffer.Len()-1])
+	assert.Equal(t, io.ErrUnexpectedEOF, cache.Load(truncated))
+	assert.Equal(t, 0, cache.Count())
+
+	source.Close()
+	assert.Equal(t, ErrClosed, source.Save(&buffer))
+}
+
+func TestCache_LoaderMetrics(t *testing.T) {
+	t.Parallel()
+	cache := NewCache[string, string]()
+	defer cache.Close()
+
+	release := make(chan struct{})
+	cache.SetLoaderFunction(func(key string) (string, time.Duration, error) {
+		if key == "fail" {
+			return "", 0, ErrNotFound
+		}
+		<-release
+		<-time.After(10 * time.Millisecond)
+		return "value", 0, nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := cache.Get("key")
+			assert.Nil(t, err)
+			assert.Equal(t, "value", data)
+		}()
+	}
+	assert.Eventually(t, func() bool {
+		return cache.GetMetrics().LoaderDeduplicated == 4
+	}, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+	cache.Get("fail")
+
+	metrics := cache.GetMetrics()
+	assert.Equal(t, int64(1), metrics.LoaderSuccesses)
+	assert.Equal(t, int64(1), metrics.LoaderFailures)
+	assert.Equal(t, int64(2), metrics.LoaderLatency.Count)
+	assert.GreaterOrEqual(t, metrics.LoaderLatency.Sum, 10*time.Millisecond)
+	assert.GreaterOrEqual(t, metrics.LoaderLatency.Quantile(1), 10*time.Millisecond)
+	assert.Equal(t, int64(6), metrics.GetLatency.Count)
+	assert.GreaterOrEqual(t, metrics.GetLatency.Quantile(0.5), 10*time.Millisecond)
+	assert.Equal(t, int64(1), metrics.SetLatency.Count)
+}
+
+func TestCache_Subscribe(t *testing.T) {
+	t.Parallel()
+	cache := NewCache[string, string]()
+
+	events, cancel := cache.Subscribe(100)
+	defer cancel()
+	cache.Set("a", "1")
+	cache.Set("a", "2")
+	cache.Touch("a")
+	cache.SetWithTTL("b", "3", 10*time.Millisecond)
+	<-time.After(30 * time.Millisecond)
+	cache.Remove("a")
+	cache.Set("c", "4")
+	cache.Close()
+
+	type received struct {
+		eventType EventType
+		key       string
+		value     string
+		reason    EvictionReason
+	}
+	var all []received
+	for event := range events {
+		assert.False(t, event.Time.IsZero())
+		all = append(all, received{event.Type, event.Key, event.Value, event.Reason})
+	}
+	assert.Equal(t, []received{
+		{EventInserted, "a", "1", 0},
+		{EventUpdated, "a", "2", 0},
+		{EventTouched, "a", "2", 0},
+		{EventInserted, "b", "3", 0},
+		{EventExpired, "b", "3", Expired},
+		{EventRemoved, "a", "2", Removed},
+		{EventInserted, "c", "4", 0},
+		{EventRemoved, "c", "4", Closed},
+	}, all)
+	assert.Equal(t, "Expired", EventExpired.String())
+}
+
+func TestCache_SubscribeSlowConsumer(t *testing.T) {
+	t.Parallel()
+	cache := NewCache[string, string]()
+	defer cache.Close()
+
+	events, cancel := cache.Subscribe(1)
+	cache.Set("a", "1")
+	cache.Set("b", "2")
+	cache.Set("c", "3")
+	assert.Equal(t, int64(2), cache.GetMetrics().EventsDropped)
+
+	// a slow consumer gets the oldest events
+	event := <-events
+	assert.Equal(t, "a", event.Key)
+	cancel()
+	cancel()
+	_, open := <-events
+	assert.False(t, open)
+
+	cache.Close()
+	events, cancel = cache.Subscribe(1)
+	defer cancel()
+	_, open = <-events
+	assert.False(t, open)
+}
+
+func TestCache_Range(t *testing.T) {
+	t.Parallel()
+	cache := NewCache[string, int]()
+	defer cache.Close()
+
+	cache.SetStaleWhileRevalidate(time.Minute)
+	cache.SetWithTTL("forever", 1, ItemNotExpire)
+	cache.SetWithTTL("hour", 2, time.Hour)
+	cache.SetWithTTL("stale", 3, time.Millisecond)
+	<-time.After(5 * time.Millisecond)
+
+	expiresAt := map[string]time.Time{}
+	cache.Range(func(key string, value int, expires time.Time) bool {
+		expiresAt[key] = expires
+		return true
+	})
+	assert.Len(t, expiresAt, 2)
+	assert.True(t, expiresAt["forever"].IsZero())
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiresAt["hour"], time.Second)
+
+	// the items are not touched, and the cache can be used while ranging
+	visited := 0
+	cache.Range(func(key string, value int, expires time.Time) bool {
+		assert.Equal(t, expiresAt[key], expires)
+		assert.Nil(t, cache.Remove(key))
+		visited++
+		return false
+	})
+	assert.Equal(t, 1, visited)
+	assert.Equal(t, 2, cache.Count())
+
+	cache.Close()
+	cache.Range(func(key string, value int, expires time.Time) bool {
+		t.Fatal("Expected no items once closed")
+		return true
+	})
+}
+
+func TestCache_GetMulti(t *testing.T) {
+	t.Parallel()
+	cache := NewCache[string, string]()
+	defer cache.Close()
+
+	var calls [][]string
+	cache.SetBatchLoaderFunction(func(keys []string) (map[string]Result[string], error) {
+		calls = append(calls, keys)
+		results := map[string]Result[string]{}
+		for _, key := range keys {
+			if key != "missing" {
+				results[key] = Result[string]{Data: "loaded " + key}
+			}
+		}
+		return results, nil
+	})
+	cache.SetMultiWithTTL(map[string]string{"a": "1", "b": "2"}, time.Hour)
+
+	data, err := cache.GetMulti([]string{"a", "b", "c", "d", "missing", "a"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"a": "1", "b": "2", "c": "loaded c", "d": "loaded d"}, data)
+	assert.Len(t, calls, 1)
+	assert.ElementsMatch(t, []string{"c", "d", "missing"}, calls[0])
+
+	data, err = cache.GetMulti([]string{"c", "d"})
+	assert.Nil(t, err)
+	assert.Len(t, data, 2)
+	assert.Len(t, calls, 1, "Expected loaded keys to be cached")
+
+	metrics := cache.GetMetrics()
+	assert.Equal(t, int64(7), metrics.Hits)
+	assert.Equal(t, int64(3), metrics.Misses)
+	assert.Equal(t, int64(1), metrics.LoaderSuccesses)
+	assert.Equal(t, int64(4), metrics.Inserted)
+
+	removed, err := cache.RemoveMulti([]string{"a", "c", "missing"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, removed)
+	assert.ElementsMatch(t, []string{"b", "d"}, cache.GetKeys())
+
+	cache.Close()
+	_, err = cache.GetMulti([]string{"a"})
+	assert.Equal(t, ErrClosed, err)
+	assert.Equal(t, ErrClosed, cache.SetMultiWithTTL(map[string]string{"a": "1"}, 0))
+	_, err = cache.RemoveMulti([]string{"a"})
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestCache_GetMultiLoaderErrors(t *testing.T) {
+	t.Parallel()
+	cache := NewCache[string, string]()
+	defer cache.Close()
+
+	calls := 0
+	cache.SetNegativeCaching(time.Minute, nil)
+	cache.SetBatchLoaderFunction(func(keys []string) (map[string]Result[string], error) {
+		calls++
+		if calls == 1 {
+			return nil, ErrNotFound
+		}
+		return map[string]Result[string]{"b": {Data: "2"}}, nil
+	})
+	data, err := cache.GetMulti([]string{"a"})
+	assert.Equal(t, ErrNotFound, err)
+	assert.Empty(t, data)
+
+	// the failure is cached for a, b is loaded
+	data, err = cache.GetMulti([]string{"a", "b"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"b": "2"}, data)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, int64(1), cache.GetMetrics().NegativeHits)
+}
+
+func TestCache_GetMultiLoadFailures(t *testing.T) {
+	t.Parallel()
+	cache := NewCache[string, string]()
+	defer cache.Close()
+
+	loaderErr := errors.New("failed")
+	started := make(chan string, 1)
+	release := make(chan struct{})
+	cache.SetLoaderFunction(func(key string) (string, time.Duration, error) {
+		if key == "x" {
+			started <- key
+			<-release
+		}
+		if key != "a" {
+			return "", 0, loaderErr
+		}
+		return "loaded " + key, 0, nil
+	})
+
+	// without a batch loader the error of a failed key is returned
+	data, err := cache.GetMulti([]string{"a", "b"})
+	assert.Equal(t, loaderErr, err)
+	assert.Equal(t, map[string]string{"a": "loaded a"}, data)
+
+	// a failed load joined by GetMulti is not reported as loaded
+	batchStarted := make(chan struct{})
+	cache.SetBatchLoaderFunction(func(keys []string) (map[string]Result[string], error) {
+		close(batchStarted)
+		<-release
+		panic("batch loader")
+	})
+	go func() {
+		_, err := cache.Get("x")
+		assert.Equal(t, loaderErr, err)
+	}()
+	<-started
+	multiDone := make(chan struct{})
+	go func() {
+		defer close(multiDone)
+		data, err := cache.GetMulti([]string{"x"})
+		assert.Nil(t, err)
+		assert.Empty(t, data)
+	}()
+	assert.Eventually(t, func() bool {
+		return cache.GetMetrics().LoaderDeduplicated == 1
+	}, time.Second, time.Millisecond)
+
+	// the callers waiting for the keys of a batch loader that panics get an error
+	panicked := make(chan interface{})
+	go func() {
+		defer func() {
+			panicked <- recover()
+		}()
+		cache.GetMulti([]string{"y"})
+	}()
+	<-batchStarted
+	getDone := make(chan struct{})
+	go func() {
+		defer close(getDone)
+		_, err := cache.Get("y")
+		assert.ErrorIs(t, err, ErrLoaderPanic)
+	}()
+	assert.Eventually(t, func() bool {
+		return cache.GetMetrics().LoaderDeduplicated == 2
+	}, time.Second, time.Millisecond)
+	close(release)
+	<-multiDone
+	assert.Equal(t, "batch loader", <-panicked)
+	<-getDone
+}
+
+func TestCache_GetMultiDeduplication(t *testing.T) {
+	t.Parallel()
+	cache := NewCache[string, string]()
+	defer cache.Close()
+
+	started := make(chan string, 2)
+	release := make(chan struct{})
+	cache.SetLoaderFunction(func(key string) (string, time.Duration, error) {
+		started <- key
+		<-release
+		return "single " + key, 0, nil
+	})
+	batchKeys := make(chan []string, 2)
+	cache.SetBatchLoaderFunction(func(keys []string) (map[string]Result[string], error) {
+		batchKeys <- keys
+		<-release
+		results := map[string]Result[string]{}
+		for _, key := range keys {
+			results[key] = Result[string]{Data: "batch " + key}
+		}
+		return results, nil
+	})
+
+	// GetMulti waits for the load of Get and Get waits for the load of GetMulti
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		data, err := cache.Get("x")
+		assert.Nil(t, err)
+		assert.Equal(t, "single x", data)
+	}()
+	assert.Equal(t, "x", <-started)
+	go func() {
+		defer wg.Done()
+		data, err := cache.GetMulti([]string{"x", "y"})
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{"x": "single x", "y": "batch y"}, data)
+	}()
+	assert.Equal(t, []string{"y"}, <-batchKeys)
+	assert.Eventually(t, func() bool {
+		return cache.GetMetrics().LoaderDeduplicated == 1
+	}, time.Second, time.Millisecond)
+	loaded := make(chan string)
+	go func() {
+		data, err := cache.Get("y")
+		assert.Nil(t, err)
+		loaded <- data
+	}()
+	assert.Eventually(t, func() bool {
+		return cache.GetMetrics().LoaderDeduplicated == 2
+	}, time.Second, time.Millisecond)
+	close(release)
+	assert.Equal(t, "batch y", <-loaded)
+	wg.Wait()
+	assert.Len(t, started, 0)
+}
+
+func TestCache_AtomicOperations(t *testing.T) {
+	t.Parallel()
+	cache := NewCache[string, int]()
+	defer cache.Close()
+
+	inserted := make(chan string, 10)
+	cache.SetNewItemCallback(func(key string, value int) {
+		inserted <- key
+	})
+
+	value, loaded, err := cache.GetOrSet("a", 1, time.Hour)
+	assert.Nil(t, err)
+	assert.False(t, loaded)
+	assert.Equal(t, 1, value)
+	value, loaded, err = cache.GetOrSet("a", 2, time.Hour)
+	assert.Nil(t, err)
+	assert.True(t, loaded)
+	assert.Equal(t, 1, value)
+
+	added, err := cache.SetIfAbsent("a", 3, time.Hour)
+	assert.Nil(t, err)
+	assert.False(t, added)
+	added, err = cache.SetIfAbsent("b", 3, time.Hour)
+	assert.Nil(t, err)
+	assert.True(t, added)
+
+	replaced, err := cache.Replace("missing", 4, time.Hour)
+	assert.Nil(t, err)
+	assert.False(t, replaced)
+	_, err = cache.Get("missing")
+	assert.Equal(t, ErrNotFound, err)
+	replaced, err = cache.Replace("b", 4, time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, replaced)
+	value, remaining, _ := cache.GetWithTTL("b")
+	assert.Equal(t, 4, value)
+	assert.LessOrEqual(t, remaining, time.Minute)
+
+	swapped, err := cache.CompareAndSwap("b", 3, 5)
+	assert.Nil(t, err)
+	assert.False(t, swapped)
+	swapped, err = cache.CompareAndSwap("b", 4, 5)
+	assert.Nil(t, err)
+	assert.True(t, swapped)
+	value, remaining, _ = cache.GetWithTTL("b")
+	assert.Equal(t, 5, value)
+	assert.LessOrEqual(t, remaining, time.Minute, "CompareAndSwap keeps the ttl of the item")
+
+	assert.Equal(t, "a", <-inserted)
+	assert.Equal(t, "b", <-inserted)
+	assert.Len(t, inserted, 0, "Updates do not call the new item callback")
+
+	cache.Close()
+	_, _, err = cache.GetOrSet("a", 1, time.Hour)
+	assert.Equal(t, ErrClosed, err)
+	_, err = cache.SetIfAbsent("a", 1, time.Hour)
+	assert.Equal(t, ErrClosed, err)
+	_, err = cache.Replace("a", 1, time.Hour)
+	assert.Equal(t, ErrClosed, err)
+	_, err = cache.CompareAndSwap("a", 1, 2)
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestCache_AtomicOperationsExpiredItems(t *testing.T) {
+	t.Parallel()
+	cache := NewCache[string, int]()
+	defer cache.Close()
+
+	// items that expired but were not cleaned up yet are absent
+	cache.SetWithTTL("a", 1, time.Millisecond)
+	cache.SetWithTTL("b", 1, time.Millisecond)
+	<-time.After(5 * time.Millisecond)
+	added, err := cache.SetIfAbsent("a", 2, time.Hour)
+	assert.Nil(t, err)
+	assert.True(t, added)
+	swapped, err := cache.CompareAndSwap("b", 1, 2)
+	assert.Nil(t, err)
+	assert.False(t, swapped)
+
+	<-time.After(10 * time.Millisecond)
+	value, err := cache.Get("a")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, value)
+}
+
+func TestCache_Compute(t *testing.T) {
+	t.Parallel()
+	cache := NewCache[string, int]()
+	defer cache.Close()
+
+	expired := make(chan EvictionReason, 1)
+	cache.SetExpirationReasonCallback(func(key string, reason EvictionReason, value int) {
+		expired <- reason
+	})
+
+	increment := func(old int, exists bool) (int, time.Duration, bool) {
+		return old + 1, time.Hour, false
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cache.Compute("counter", increment)
+		}()
+	}
+	wg.Wait()
+	value, err := cache.Get("counter")
+	assert.Nil(t, err)
+	assert.Equal(t, 100, value)
+
+	value, err = cache.Compute("counter", func(old int, exists bool) (int, time.Duration, bool) {
+		assert.True(t, exists)
+		assert.Equal(t, 100, old)
+		return 0, 0, true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, value)
+	assert.Equal(t, Removed, <-expired)
+	assert.Equal(t, 0, cache.Count())
+
+	// removing a missing key is a no-op
+	_, err = cache.Compute("counter", func(old int, exists bool) (int, time.Duration, bool) {
+		assert.False(t, exists)
+		return 0, 0, true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), cache.GetMetrics().Removed)
+
+	// the ttl returned by f is used and the item is put in the expiration heap
+	cache.Compute("short", func(old int, exists bool) (int, time.Duration, bool) {
+		return 1, 10 * time.Millisecond, false
+	})
+	assert.Equal(t, Expired, <-expired)
+	assert.Equal(t, 0, cache.Count())
+
+	cache.Close()
+	_, err = cache.Compute("counter", increment)
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestCache_AtomicOperationsPanics(t *testing.T) {
+	t.Parallel()
+	cache := NewCache[string, []int]()
+	defer cache.Close()
+
+	cache.Set("slice", []int{1})
+	assert.Panics(t, func() {
+		cache.CompareAndSwap("slice", []int{1}, []int{2})
+	}, "slices are not comparable")
+	assert.Panics(t, func() {
+		cache.Compute("slice", func(old []int, exists bool) ([]int, time.Duration, bool) {
+			panic("compute")
+		})
+	})
+
+	// the lock was released and the key left as it was
+	value, err := cache.Get("slice")
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1}, value)
+	value, err = cache.Compute("slice", func(old []int, exists bool) ([]int, time.Duration, bool) {
+		return append(old, 2), 0, false
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1, 2}, value)
+}
+
+func TestCache_Versioning(t *testing.T) {
+	t.Parallel()
+	cache := NewCache[string, string]()
+	defer cache.Close()
+
+	_, version, err := cache.GetVersioned("a")
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, uint64(0), version)
+	assert.Nil(t, cache.SetIfVersion("a", "1", time.Hour, 0))
+
+	data, version, err := cache.GetVersioned("a")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", data)
+	assert.NotEqual(t, uint64(0), version)
+	assert.Nil(t, cache.Touch("a"))
+	_, touched, _ := cache.GetVersioned("a")
+	assert.Equal(t, version, touched, "Touch does not change the version")
+
+	// someone else overwrote the key in the meantime
+	cache.Set("a", "2")
+	err = cache.SetIfVersion("a", "3", time.Hour, version)
+	assert.True(t, errors.Is(err, ErrVersionMismatch))
+	var mismatch VersionMismatchError
+	assert.True(t, errors.As(err, &mismatch))
+	assert.Equal(t, version, mismatch.Expected)
+	assert.Greater(t, mismatch.Current, version)
+	assert.Equal(t, mismatch.Current, mustVersion(t, cache, "a"))
+
+	assert.Nil(t, cache.SetIfVersion("a", "3", time.Hour, mismatch.Current))
+	assert.Greater(t, mustVersion(t, cache, "a"), mismatch.Current)
+	data, _ = cache.Get("a")
+	assert.Equal(t, "3", data)
+
+	// a removed key does not come back with its old version
+	removedVersion := mustVersion(t, cache, "a")
+	assert.Nil(t, cache.Remove("a"))
+	assert.True(t, errors.Is(cache.SetIfVersion("a", "4", time.Hour, removedVersion), ErrVersionMismatch))
+	assert.Nil(t, cache.SetIfVersion("a", "4", time.Hour, 0))
+	assert.Greater(t, mustVersion(t, cache, "a"), removedVersion)
+
+	// the versions survive Save and Load, later changes get higher versions
+	cache.Set("b", "1")
+	var buffer bytes.Buffer
+	assert.Nil(t, cache.Save(&buffer))
+	restored := NewCache[string, string]()
+	defer restored.Close()
+	assert.Nil(t, restored.Load(&buffer))
+	assert.Equal(t, mustVersion(t, cache, "a"), mustVersion(t, restored, "a"))
+	assert.Equal(t, mustVersion(t, cache, "b"), mustVersion(t, restored, "b"))
+	restored.Set("a", "5")
+	assert.Greater(t, mustVersion(t, restored, "a"), mustVersion(t, cache, "b"))
+
+	cache.Close()
+	_, _, err = cache.GetVersioned("a")
+	assert.Equal(t, ErrClosed, err)
+	assert.Equal(t, ErrClosed, cache.SetIfVersion("a", "1", time.Hour, 0))
+}
+
+func mustVersion(t *testing.T, cache *Cache[string, string], key string) uint64 {
+	_, version, err := cache.GetVersioned(key)
+	assert.Nil(t, err)
+	return version
+}
+
+func TestCache_RemoveByTag(t *testing.T) {
+	t.Parallel()
+	cache := NewCache[string, string]()
+	defer cache.Close()
+
+	removed := make(chan string, 10)
+	cache.SetExpirationReasonCallback(func(key string, reason EvictionReason, value string) {
+		if reason == Removed {
+			removed <- key
+		}
+	})
+	cache.SetWithTags("user:1", "a", time.Hour, "tenant:42", "users")
+	cache.SetWithTags("user:2", "b", time.Hour, "tenant:42", "users", "users")
+	cache.SetWithTags("user:3", "c", time.Hour, "tenant:7", "users")
+	cache.Set("untagged", "e")
+
+	// updates without tags keep them, SetWithTags replaces them
+	cache.Set("user:2", "updated")
+	cache.SetWithTags("user:3", "c", time.Hour, "tenant:42")
+
+	count, err := cache.RemoveByTag("tenant:42")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, count)
+	assert.ElementsMatch(t, []string{"untagged"}, cache.GetKeys())
+	assert.ElementsMatch(t, []string{"user:1", "user:2", "user:3"}, []string{<-removed, <-removed, <-removed})
+
+	count, err = cache.RemoveByTag("users")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count, "The removed items left the tag index")
+	assert.Equal(t, int64(3), cache.GetMetrics().Removed)
+
+	// the tags survive Save and Load
+	cache.SetWithTags("user:4", "f", time.Hour, "tenant:42")
+	var buffer bytes.Buffer
+	assert.Nil(t, cache.Save(&buffer))
+	restored := NewCache[string, string]()
+	defer restored.Close()
+	assert.Nil(t, restored.Load(&buffer))
+	count, err = restored.RemoveByTag("tenant:42")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	cache.Close()
+	_, err = cache.RemoveByTag("users")
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestCache_RemoveByPrefix(t *testing.T) {
+	t.Parallel()
+	type key string
+	cache := NewCache[key, int]()
+	defer cache.Close()
+
+	cache.SetCacheSizeLimit(5)
+	expired := make(chan key, 10)
+	cache.SetExpirationCallback(func(k key, value int) {
+		expired <- k
+	})
+	for _, k := range []key{"tenant:42:a", "tenant:42:b", "tenant:420:a", "tenant:7:a"} {
+		cache.Set(k, 1)
+	}
+	cache.SetWithTTL("tenant:42:short", 1, 10*time.Millisecond)
+	assert.Equal(t, key("tenant:42:short"), <-expired)
+	// an eviction leaves the index as well
+	cache.Set("other", 1)
+	cache.Set("other2", 1)
+	evicted := <-expired
+
+	count, err := cache.RemoveByPrefix("tenant:42:")
+	assert.Nil(t, err)
+	if evicted == "tenant:42:a" || evicted == "tenant:42:b" {
+		assert.Equal(t, 1, count)
+	} else {
+		assert.Equal(t, 2, count)
+	}
+	for _, k := range cache.GetKeys() {
+		assert.False(t, strings.HasPrefix(string(k), "tenant:42:"))
+	}
+	// the index built by the first call follows the keys set after it
+	cache.Set("tenant:42:c", 1)
+	cache.Purge()
+	cache.Set("tenant:42:d", 1)
+	count, err = cache.RemoveByPrefix("tenant:42:")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, 0, cache.Count())
+
+	ints := NewCache[int, int]()
+	defer ints.Close()
+	_, err = ints.RemoveByPrefix("1")
+	assert.Equal(t, ErrPrefixUnsupported, err)
+}
+
+func TestCache_TimingWheel(t *testing.T) {
+	t.Parallel()
+	cache := NewCache[string, string]()
+	defer cache.Close()
+
+	cache.SetWithTTL("before", "a", 20*time.Millisecond)
+	cache.SetExpirationQueue(func() ExpirationQueue {
+		return NewTimingWheel(time.Millisecond)
+	})
+	expired := make(chan string, 10)
+	cache.SetExpirationCallback(func(key string, value string) {
+		expired <- key
+	})
+	cache.SetWithTTL("forever", "b", ItemNotExpire)
+	cache.SetWithTTL("short", "c", 10*time.Millisecond)
+	cache.SetWithTTL("long", "d", 50*time.Millisecond)
+
+	// items expire at most a tick late, plus the scheduling of the expiration goroutine
+	start := time.Now()
+	for _, key := range []string{"short", "before", "long"} {
+		select {
+		case expiredKey := <-expired:
+			assert.Equal(t, key, expiredKey)
+		case <-time.After(time.Second):
+			t.Fatalf("%s did not expire", key)
+		}
+	}
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+	assert.Equal(t, []string{"forever"}, cache.GetKeys())
+
+	// Purge keeps the timing wheel
+	cache.Purge()
+	cache.SetWithTTL("after purge", "e", 10*time.Millisecond)
+	assert.Equal(t, "after purge", <-expired)
+	assert.Equal(t, 0, cache.Count())
+}
+
+func TestCache_TimingWheelFakeClock(t *testing.T) {
+	t.Parallel()
+	clock := ttltest.NewFakeClock(time.Unix(1000, 0))
+	cache, err := NewCacheWithOptions[string, string](WithClock(clock), WithExpirationQueue(func() ExpirationQueue {
+		return NewTimingWheel(time.Second)
+	}))
+	assert.Nil(t, err)
+	defer cache.Close()
+
+	// the wheel counts its ticks from the time of the clock, also once it is created again by Purge
+	for i := 0; i < 2; i++ {
+		cache.SetWithTTL("a", "a", 10*time.Second)
+		cache.SetWithTTL("b", "b", time.Minute)
+		clock.Advance(9 * time.Second)
+		assert.Equal(t, 2, cache.Count())
+		clock.Advance(2 * time.Second)
+		assert.Equal(t, []string{"b"}, cache.GetKeys())
+		cache.Purge()
+	}
+}
+
+func TestCache_TouchExpirationQueues(t *testing.T) {
+	t.Parallel()
+	queues := map[string]func() ExpirationQueue{
+		"heap": func() ExpirationQueue {
+			return NewExpirationHeap()
+		},
+		"wheel": func() ExpirationQueue {
+			return NewTimingWheel(time.Second)
+		},
+	}
+	for name, newQueue := range queues {
+		t.Run(name, func(t *testing.T) {
+			clock := ttltest.NewFakeClock(time.Unix(1000, 0))
+			cache, err := NewCacheWithOptions[string, string](WithClock(clock), WithExpirationQueue(newQueue))
+			assert.Nil(t, err)
+			defer cache.Close()
+
+			// the touched item moves in the queue, b expires before it
+			cache.SetWithTTL("b", "b", 12*time.Second)
+			cache.SetWithTTL("a", "a", 10*time.Second)
+			clock.Advance(9 * time.Second)
+			assert.Nil(t, cache.Touch("a"))
+			clock.Advance(4 * time.Second)
+			assert.Equal(t, []string{"a"}, cache.GetKeys())
+			clock.Advance(7 * time.Second)
+			assert.Empty(t, cache.GetKeys())
+
+			cache.Close()
+			assert.Equal(t, ErrClosed, cache.Touch("a"))
+		})
+	}
+}
+
+func TestCache_FakeClock(t *testing.T) {
+	t.Parallel()
+	cache := NewCache[string, string]()
+	defer cache.Close()
+
+	clock := ttltest.NewFakeClock(time.Unix(1000, 0))
+	cache.SetClock(clock)
+	expired := make(chan string, 10)
+	cache.SetExpirationCallback(func(key string, value string) {
+		expired <- key
+	})
+	cache.SetWithTTL("short", "a", time.Minute)
+	cache.SetWithTTL("long", "b", time.Hour)
+	cache.SetWithTTL("forever", "c", ItemNotExpire)
+
+	clock.Advance(59 * time.Second)
+	assert.Equal(t, 3, cache.Count())
+	_, ttl, err := cache.GetWithTTL("short")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Minute, ttl, "the Get touched short")
+
+	clock.Advance(time.Second)
+	assert.Equal(t, 3, cache.Count())
+	clock.Advance(59 * time.Second)
+	assert.Equal(t, 2, cache.Count())
+	assert.Equal(t, "short", <-expired)
+	assert.Equal(t, int64(1), cache.GetMetrics().EvictedExpired)
+
+	clock.Advance(2 * time.Hour)
+	assert.Equal(t, []string{"forever"}, cache.GetKeys())
+	assert.Equal(t, "long", <-expired)
+	assert.Equal(t, time.Unix(1000, 0).Add(2*time.Hour+2*time.Minute-time.Second), clock.Now())
+
+	// back to the time package
+	cache.SetClock(nil)
+	cache.SetWithTTL("real", "d", 10*time.Millisecond)
+	assert.Equal(t, "real", <-expired)
+}
+
+func TestCache_SetClockTimingWheel(t *testing.T) {
+	t.Parallel()
+	cache, err := NewCacheWithOptions[string, string](WithExpirationQueue(func() ExpirationQueue {
+		return NewTimingWheel(time.Second)
+	}))
+	assert.Nil(t, err)
+	defer cache.Close()
+
+	// the wheel started at the time of the real clock is rebuilt at the time of the fake one
+	cache.SetWithTTL("forever", "b", ItemNotExpire)
+	clock := ttltest.NewFakeClock(time.Unix(1000, 0))
+	cache.SetClock(clock)
+	cache.SetWithTTL("a", "a", 10*time.Second)
+	clock.Advance(11 * time.Second)
+	assert.Equal(t, []string{"forever"}, cache.GetKeys())
+}
+
+func TestCache_ManualExpiration(t *testing.T) {
+	t.Parallel()
+	// no goroutine is started, goleak would report the caches that are not closed
+	for i := 0; i < 100; i++ {
+		NewManualCache[int, int]().SetWithTTL(i, i, time.Hour)
+	}
+
+	cache := NewManualCache[string, string]()
+	clock := ttltest.NewFakeClock(time.Unix(0, 0))
+	cache.SetClock(clock)
+	reasons := make(chan EvictionReason, 10)
+	cache.SetExpirationReasonCallback(func(key string, reason EvictionReason, value string) {
+		reasons <- reason
+	})
+	cache.SetWithTTL("a", "a", time.Minute)
+	cache.SetWithTTL("b", "b", time.Hour)
+	cache.SetWithTTL("c", "c", time.Hour)
+	cache.SetWithTTL("forever", "d", ItemNotExpire)
+	next, err := cache.Tick()
+	assert.Nil(t, err)
+	assert.Equal(t, time.Minute, next)
+
+	// expired lazily on access
+	clock.Advance(time.Minute)
+	_, err = cache.Get("a")
+	assert.Equal(t, ErrNotFound, err)
+	assert.Equal(t, Expired, <-reasons)
+	assert.Equal(t, 3, cache.Count())
+
+	// or explicitly
+	clock.Advance(time.Hour)
+	assert.Nil(t, cache.ExpireNow())
+	assert.Equal(t, Expired, <-reasons)
+	assert.Equal(t, Expired, <-reasons)
+	assert.Equal(t, int64(3), cache.GetMetrics().EvictedExpired)
+	next, err = cache.Tick()
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), next, "forever does not expire")
+
+	assert.Nil(t, cache.Close())
+	assert.Equal(t, Closed, <-reasons)
+	assert.Equal(t, ErrClosed, cache.ExpireNow())
+}
+
+func TestCache_Janitor(t *testing.T) {
+	t.Parallel()
+	janitor := NewJanitor()
+
+	expired := make(chan string, 100)
+	caches := make([]*Cache[string, string], 10)
+	for i := range caches {
+		var err error
+		caches[i], err = NewCacheWithOptions[string, string](WithJanitor(janitor))
+		assert.Nil(t, err)
+		caches[i].SetExpirationReasonCallback(func(key string, reason EvictionReason, value string) {
+			expired <- fmt.Sprint(key, reason)
+		})
+		caches[i].SetWithTTL("short", "a", time.Duration(i+1)*10*time.Millisecond)
+		caches[i].SetWithTTL("long", "b", time.Hour)
+	}
+	for i := range caches {
+		select {
+		case key := <-expired:
+			assert.Equal(t, fmt.Sprint("short", Expired), key)
+		case <-time.After(time.Second):
+			t.Fatalf("%d items expired instead of %d", i, len(caches))
+		}
+		assert.Equal(t, 1, caches[i].Count())
+	}
+
+	// a closed cache is deregistered
+	assert.Nil(t, caches[0].Close())
+	assert.Equal(t, fmt.Sprint("long", Closed), <-expired)
+
+	// once the janitor is closed the caches expire their items lazily
+	assert.Nil(t, janitor.Close())
+	assert.Equal(t, ErrClosed, janitor.Close())
+	caches[1].SetWithTTL("short", "a", time.Millisecond)
+	<-time.After(10 * time.Millisecond)
+	assert.Equal(t, 1, caches[1].Count())
+	assert.Equal(t, fmt.Sprint("short", Expired), <-expired)
+
+	// as the caches created with it
+	closed, err := NewCacheWithOptions[string, string](WithJanitor(janitor))
+	assert.Nil(t, err)
+	closed.SetWithTTL("short", "a", time.Millisecond)
+	<-time.After(10 * time.Millisecond)
+	_, err = closed.Get("short")
+	assert.Equal(t, ErrNotFound, err)
+	assert.Nil(t, closed.Close())
+	for _, cache := range caches[1:] {
+		assert.Nil(t, cache.Close())
+	}
+}
+
+func TestCache_JanitorFakeClock(t *testing.T) {
+	t.Parallel()
+	clock := ttltest.NewFakeClock(time.Unix(1000, 0))
+	janitor := NewJanitor(WithJanitorClock(clock))
+	defer janitor.Close()
+
+	// the caches get the clock of the janitor
+	expired := make(chan string, 10)
+	caches := make([]*Cache[string, string], 2)
+	for i := range caches {
+		var err error
+		caches[i], err = NewCacheWithOptions[string, string](WithJanitor(janitor))
+		assert.Nil(t, err)
+		defer caches[i].Close()
+		caches[i].SetExpirationCallback(func(key string, value string) {
+			expired <- key
+		})
+		caches[i].SetWithTTL(fmt.Sprint("short", i), "a", time.Duration(i+1)*time.Minute)
+		caches[i].SetWithTTL("long", "b", time.Hour)
+	}
+
+	clock.Advance(59 * time.Second)
+	assert.Equal(t, 2, caches[0].Count())
+	clock.Advance(time.Second)
+	assert.Equal(t, 1, caches[0].Count())
+	assert.Equal(t, "short0", <-expired)
+	assert.Equal(t, 2, caches[1].Count())
+
+	clock.Advance(time.Minute)
+	assert.Equal(t, 1, caches[1].Count())
+	assert.Equal(t, "short1", <-expired)
+
+	clock.Advance(time.Hour)
+	assert.Equal(t, 0, caches[0].Count()+caches[1].Count())
+	assert.Equal(t, "long", <-expired)
+	assert.Equal(t, "long", <-expired)
+}
+
+func TestCache_Options(t *testing.T) {
+	t.Parallel()
+	clock := ttltest.NewFakeClock(time.Unix(0, 0))
+	reasons := make(chan EvictionReason, 10)
+	cache, err := NewCacheWithOptions[string, int](
+		WithTTL(time.Minute),
+		WithSizeLimit(2),
+		WithEvictionPolicy[string](NewLRUPolicy[string]()),
+		WithClock(clock),
+		WithSkipTTLExtension(),
+		WithLoader(func(key string) (int, time.Duration, error) {
+			return len(key), 0, nil
+		}),
+		WithExpirationReasonCallback(func(key string, reason EvictionReason, value int) {
+			reasons <- reason
+		}),
+		WithCheckExpirationCallback(func(key string, value int) bool {
+			return key != "keep"
+		}),
+	)
+	assert.Nil(t, err)
+	defer cache.Close()
+
+	value, err := cache.Get("abc")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, value)
+	cache.Set("keep", 0)
+	cache.Set("c", 0)
+	assert.Equal(t, EvictedSize, <-reasons, "the size limit evicts the least recently used abc")
+
+	clock.Advance(time.Minute)
+	assert.Equal(t, Expired, <-reasons)
+	assert.Equal(t, []string{"keep"}, cache.GetKeys())
+
+	janitor := NewJanitor()
+	defer janitor.Close()
+	invalid := []struct {
+		option string
+		opts   []Option
+	}{
+		{"WithTTL", []Option{WithTTL(-time.Second)}},
+		{"WithSizeLimit", []Option{WithSizeLimit(-1)}},
+		{"WithRefreshAhead", []Option{WithRefreshAhead(1.5)}},
+		{"WithRefreshAhead", []Option{WithRefreshAhead(0.5)}},
+		{"WithStaleWhileRevalidate", []Option{WithStaleWhileRevalidate(time.Minute)}},
+		{"WithNegativeCaching", []Option{WithNegativeCaching(time.Minute, nil)}},
+		{"WithWeigher", []Option{WithWeigher(func(key string, value int) int64 { return 1 })}},
+		{"WithEvictionPolicy", []Option{WithEvictionPolicy[string](NewLFUPolicy[string]())}},
+		{"WithJanitor", []Option{WithJanitor(janitor), WithManualExpiration()}},
+		{"WithLoader", []Option{WithLoader(func(key int) (int, time.Duration, error) { return key, 0, nil })}},
+		{"WithEvictionPolicy", []Option{WithSizeLimit(1), WithEvictionPolicy[int](NewLRUPolicy[int]())}},
+	}
+	for _, test := range invalid {
+		_, err := NewCacheWithOptions[string, int](test.opts...)
+		assert.True(t, errors.Is(err, ErrInvalidOption), test.option)
+		var optionErr OptionError
+		assert.True(t, errors.As(err, &optionErr), test.option)
+		assert.Equal(t, test.option, optionErr.Option)
+	}
+}
+
+func TestCache_CallbackDispatcher(t *testing.T) {
+	t.Parallel()
+
+	// the ordered dispatcher runs the callbacks in the order the items were removed, Close waits for them
+	var lock sync.Mutex
+	var removed []int
+	cache, err := NewCacheWithOptions[int, int](
+		WithCallbackDispatcher(NewOrderedDispatcher()),
+		WithExpirationReasonCallback(func(key int, reason EvictionReason, value int) {
+			lock.Lock()
+			defer lock.Unlock()
+			removed = append(removed, key)
+		}),
+	)
+	assert.Nil(t, err)
+	expected := make([]int, 1000)
+	for i := range expected {
+		expected[i] = i
+		cache.Set(i, i)
+	}
+	for _, key := range expected[:500] {
+		cache.Remove(key)
+	}
+	cache.Close()
+	lock.Lock()
+	assert.Equal(t, expected[:500], removed[:500])
+	assert.ElementsMatch(t, expected, removed)
+	lock.Unlock()
+
+	// the pool dispatcher runs up to its amount of workers, the panics are reported to the error hook
+	dispatcher := NewPoolDispatcher(4)
+	var panics []error
+	dispatcher.SetErrorHook(func(err error) {
+		lock.Lock()
+		defer lock.Unlock()
+		panics = append(panics, err)
+	})
+	var running, maxRunning int32
+	pooled, err := NewCacheWithOptions[int, int](WithCallbackDispatcher(dispatcher))
+	assert.Nil(t, err)
+	pooled.SetExpirationCallback(func(key int, value int) {
+		current := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			seen := atomic.LoadInt32(&maxRunning)
+			if current <= seen || atomic.CompareAndSwapInt32(&maxRunning, seen, current) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		if key%2 == 1 {
+			panic(fmt.Sprint("odd key ", key))
+		}
+	})
+	for i := 0; i < 100; i++ {
+		pooled.Set(i, i)
+	}
+	pooled.Close()
+	assert.LessOrEqual(t, maxRunning, int32(4))
+	lock.Lock()
+	assert.Len(t, panics, 50)
+	assert.True(t, errors.Is(panics[0], ErrCallbackPanic))
+	var panicErr CallbackPanicError
+	assert.True(t, errors.As(panics[0], &panicErr))
+	assert.Contains(t, panicErr.Value, "odd key")
+	lock.Unlock()
+
+	// the sync dispatcher runs the callbacks before Remove returns
+	synced, err := NewCacheWithOptions[int, int](WithCallbackDispatcher(NewSyncDispatcher()))
+	assert.Nil(t, err)
+	defer synced.Close()
+	calls := 0
+	synced.SetExpirationCallback(func(key int, value int) {
+		calls++
+		panic("recovered without a hook")
+	})
+	synced.Set(1, 1)
+	assert.Nil(t, synced.Remove(1))
+	assert.Equal(t, 1, calls)
+
+	// the callbacks over the pending limit and the ones dispatched once the dispatcher is closed are dropped
+	bounded := NewOrderedDispatcher()
+	bounded.SetPendingLimit(1)
+	started, release := make(chan struct{}), make(chan struct{})
+	var ran []int
+	limited, err := NewCacheWithOptions[int, int](
+		WithCallbackDispatcher(bounded),
+		WithExpirationCallback(func(key int, value int) {
+			if key == 0 {
+				close(started)
+				<-release
+			}
+			lock.Lock()
+			defer lock.Unlock()
+			ran = append(ran, key)
+		}),
+	)
+	assert.Nil(t, err)
+	for i := 0; i < 4; i++ {
+		limited.Set(i, i)
+	}
+	assert.Nil(t, limited.Remove(0))
+	<-started
+	assert.Nil(t, limited.Remove(1))
+	assert.Nil(t, limited.Remove(2))
+	close(release)
+	assert.Nil(t, bounded.Close())
+	assert.Equal(t, ErrClosed, bounded.Close())
+	assert.Nil(t, limited.Remove(3))
+	assert.Nil(t, limited.Close())
+	assert.Equal(t, int64(2), bounded.Dropped())
+	lock.Lock()
+	assert.Equal(t, []int{0, 1}, ran)
+	lock.Unlock()
+}
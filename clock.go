@@ -0,0 +1,114 @@
+package ttl
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time to a cache and wakes up its expiration processing, see SetClock.
+// The ttltest package has a FakeClock to drive the expiration of a cache from tests.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is the timer of a Clock, it behaves like time.Timer
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// realClock is the Clock of the time package, the default
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (timer realTimer) C() <-chan time.Time {
+	return timer.Timer.C
+}
+
+// expirationSignal wakes up the expiration processing of one or more caches, which waits on the timer of the signal
+type expirationSignal struct {
+	notification chan bool
+	mutex        sync.Mutex
+	timer        Timer
+}
+
+func newExpirationSignal() *expirationSignal {
+	return &expirationSignal{notification: make(chan bool, 1)}
+}
+
+// start creates the timer of the expiration processing, before the processing starts so that a clock knows of it
+func (signal *expirationSignal) start(clock Clock) {
+	signal.mutex.Lock()
+	defer signal.mutex.Unlock()
+	signal.timer = clock.NewTimer(time.Hour)
+}
+
+// current returns the timer the expiration processing waits on, it changes with the clock
+func (signal *expirationSignal) current() Timer {
+	signal.mutex.Lock()
+	defer signal.mutex.Unlock()
+	return signal.timer
+}
+
+// setClock replaces the timer by one of clock that fires right away, so the expiration processing moves over to it
+func (signal *expirationSignal) setClock(clock Clock) {
+	signal.mutex.Lock()
+	defer signal.mutex.Unlock()
+	if signal.timer == nil {
+		return
+	}
+	signal.timer.Stop()
+	signal.timer = clock.NewTimer(0)
+}
+
+// notify wakes up the expiration processing so it recalculates its sleep time. The notification channel is
+// buffered, a pending notification already covers this one. The timer of a clock other than the time package
+// fires as well, so the clock knows the processing has work to do, see ttltest.FakeClock.
+func (signal *expirationSignal) notify() {
+	select {
+	case signal.notification <- true:
+	default:
+	}
+	signal.mutex.Lock()
+	defer signal.mutex.Unlock()
+	if _, real := signal.timer.(realTimer); !real && signal.timer != nil {
+		signal.timer.Reset(0)
+	}
+}
+
+// reset sets the timer to fire after sleepTime. It fires right away when a notification is pending, as the
+// sleep time may have been calculated before it. The timer is not stopped first, so a clock knows the
+// expiration processing is done once it is reset.
+func (signal *expirationSignal) reset(timer Timer, sleepTime time.Duration) {
+	signal.mutex.Lock()
+	defer signal.mutex.Unlock()
+	if timer != signal.timer {
+		// the clock changed, the notification of the change wakes up the processing
+		return
+	}
+	if len(signal.notification) > 0 {
+		sleepTime = 0
+	}
+	timer.Reset(sleepTime)
+}
+
+// stop stops the timer once the expiration processing is over
+func (signal *expirationSignal) stop() {
+	signal.mutex.Lock()
+	defer signal.mutex.Unlock()
+	signal.timer.Stop()
+	signal.timer = nil
+}
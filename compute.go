@@ -0,0 +1,166 @@
+package ttl
+
+import (
+	"time"
+)
+
+// GetOrSet returns the value of the key when it is in the cache, touching it as Get does, and true.
+// Otherwise it adds the item with the given ttl and returns data and false.
+func (cache *Cache[K, V]) GetOrSet(key K, data V, ttl time.Duration) (V, bool, error) {
+	cache.mutex.Lock()
+	if cache.isShutDown {
+		cache.mutex.Unlock()
+		var zero V
+		return zero, false, ErrClosed
+	}
+	cache.metrics.Hits++
+	item, exists, triggerExpirationNotification := cache.getItem(key)
+	if exists && item.err == nil {
+		cache.metrics.Retrievals++
+		if cache.evictionPolicy != nil {
+			cache.evictionPolicy.Access(key)
+		}
+		data = item.data
+		cache.mutex.Unlock()
+		if triggerExpirationNotification {
+			cache.notifyExpiration()
+		}
+		return data, true, nil
+	}
+	cache.metrics.Misses++
+	isNew, err := cache.store(key, data, ttl)
+	cache.mutex.Unlock()
+	cache.stored(isNew, key, data)
+	return data, false, err
+}
+
+// SetIfAbsent adds the item with the given ttl only when the key is not in the cache, it returns whether it was added
+func (cache *Cache[K, V]) SetIfAbsent(key K, data V, ttl time.Duration) (bool, error) {
+	cache.mutex.Lock()
+	if cache.isShutDown {
+		cache.mutex.Unlock()
+		return false, ErrClosed
+	}
+	if _, exists := cache.lookup(key); exists {
+		cache.mutex.Unlock()
+		return false, nil
+	}
+	isNew, err := cache.store(key, data, ttl)
+	cache.mutex.Unlock()
+	cache.stored(isNew, key, data)
+	return err == nil, err
+}
+
+// Replace sets the item with the given ttl only when the key is in the cache, it returns whether it was replaced
+func (cache *Cache[K, V]) Replace(key K, data V, ttl time.Duration) (bool, error) {
+	cache.mutex.Lock()
+	if cache.isShutDown {
+		cache.mutex.Unlock()
+		return false, ErrClosed
+	}
+	if _, exists := cache.lookup(key); !exists {
+		cache.mutex.Unlock()
+		return false, nil
+	}
+	isNew, err := cache.store(key, data, ttl)
+	cache.mutex.Unlock()
+	cache.stored(isNew, key, data)
+	return err == nil, err
+}
+
+// CompareAndSwap replaces the value of the key with new when its current value is equal to old, the item keeps its ttl
+// which starts over. It returns whether the value was swapped. As with sync.Map, the values must be comparable or it panics.
+func (cache *Cache[K, V]) CompareAndSwap(key K, old V, new V) (bool, error) {
+	swapped, isNew, err := cache.compareAndSwap(key, old, new)
+	if !swapped {
+		return false, err
+	}
+	cache.stored(isNew, key, new)
+	return err == nil, err
+}
+
+// compareAndSwap stores new when the key has the value old, it returns whether it did and whether the key is new.
+// The lock is released by a deferred call, the comparison of values that are not comparable panics.
+func (cache *Cache[K, V]) compareAndSwap(key K, old V, new V) (swapped bool, isNew bool, err error) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if cache.isShutDown {
+		return false, false, ErrClosed
+	}
+	item, exists := cache.lookup(key)
+	if !exists || any(item.data) != any(old) {
+		return false, false, nil
+	}
+	isNew, err = cache.store(key, new, item.ttl)
+	return true, isNew, err
+}
+
+// Compute sets the key to the value returned by f, which gets the current value of the key and whether it exists.
+// The key is removed instead when f returns remove. f is called while holding the cache lock, so the key can not
+// change in the meantime, but f must be fast and it can not use the cache. When f panics the lock is released and
+// the key is left as it was. Returns the new value of the key.
+func (cache *Cache[K, V]) Compute(key K, f func(old V, exists bool) (new V, ttl time.Duration, remove bool)) (V, error) {
+	var zero V
+	data, stored, isNew, err := cache.compute(key, f)
+	if !stored {
+		return zero, err
+	}
+	cache.stored(isNew, key, data)
+	if err != nil {
+		return zero, err
+	}
+	return data, nil
+}
+
+// compute calls f and stores or removes the key while holding the lock, it returns whether the value of f was stored
+// and whether the key is new. The lock is released by a deferred call, so a panic of f does not leave it held.
+func (cache *Cache[K, V]) compute(key K, f func(old V, exists bool) (new V, ttl time.Duration, remove bool)) (data V, stored bool, isNew bool, err error) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if cache.isShutDown {
+		return data, false, false, ErrClosed
+	}
+	var old V
+	item, exists := cache.lookup(key)
+	if exists {
+		old = item.data
+	}
+	data, ttl, remove := f(old, exists)
+	if remove {
+		if current, found := cache.items[key]; found {
+			cache.removeItem(current, Removed)
+			err = cache.logKey(walRemove, key)
+		}
+		return data, false, false, err
+	}
+	isNew, err = cache.store(key, data, ttl)
+	return data, true, isNew, err
+}
+
+// lookup returns the item of the key when it is in the cache without touching it, cached loader errors are not returned
+func (cache *Cache[K, V]) lookup(key K) (*item[K, V], bool) {
+	cache.expireLazily()
+	item, exists := cache.items[key]
+	if !exists || item.expired(cache.clock.Now()) || item.err != nil {
+		return nil, false
+	}
+	return item, true
+}
+
+// store adds an item while holding the lock and records it in the write-ahead log, stored must be called
+// once the lock is released. It returns whether the key is new to the cache.
+func (cache *Cache[K, V]) store(key K, data V, ttl time.Duration) (bool, error) {
+	isNew, citem, err := cache.setLocked(key, data, ttl, costFromWeigher, nil)
+	if err != nil {
+		return false, err
+	}
+	return isNew, cache.logSet(citem)
+}
+
+// stored calls the new item callback and notifies the expiration processing after store
+func (cache *Cache[K, V]) stored(isNew bool, key K, data V) {
+	if isNew && cache.newItemCallback != nil {
+		cache.newItemCallback(key, data)
+	}
+	cache.notifyExpiration()
+}
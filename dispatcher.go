@@ -0,0 +1,207 @@
+package ttl
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// CallbackDispatcher runs the expiration callbacks of caches, see SetCallbackDispatcher. Without one, every
+// callback runs in a goroutine of its own. A dispatcher runs the callbacks synchronously, in order on a single
+// worker or on a bounded pool of workers. The workers are started when callbacks are pending and stop once
+// there are none left, so an idle dispatcher has no goroutines. Panics of the callbacks are recovered and
+// reported to the hook set with SetErrorHook. A dispatcher can be shared by several caches, it is closed
+// with Close once none of them is used anymore.
+type CallbackDispatcher struct {
+	mutex   sync.Mutex
+	idle    *sync.Cond
+	workers int
+	// pending holds the callbacks in the order they were dispatched, running counts the workers taking them
+	pending   []func()
+	running   int
+	errorHook func(err error)
+	// pendingLimit bounds the pending callbacks, the callbacks over it and the ones dispatched once closed are dropped
+	pendingLimit int
+	dropped      int64
+	closed       bool
+}
+
+// CallbackPanicError is reported to the error hook of a CallbackDispatcher when a callback panics
+type CallbackPanicError struct {
+	// Value is the value given to panic
+	Value interface{}
+	// Stack is the stack trace of the goroutine that panicked
+	Stack []byte
+}
+
+func (err CallbackPanicError) Error() string {
+	return fmt.Sprintf("%s: %v", ErrCallbackPanic, err.Value)
+}
+
+// Is makes errors.Is(err, ErrCallbackPanic) true
+func (err CallbackPanicError) Is(target error) bool {
+	return target == ErrCallbackPanic
+}
+
+// NewSyncDispatcher creates a CallbackDispatcher that runs the callbacks right away, while the cache is locked.
+// The callbacks must be fast and they can not use the cache.
+func NewSyncDispatcher() *CallbackDispatcher {
+	return newCallbackDispatcher(0)
+}
+
+// NewOrderedDispatcher creates a CallbackDispatcher that runs the callbacks one at a time, in the order the
+// items were removed, on a single worker
+func NewOrderedDispatcher() *CallbackDispatcher {
+	return newCallbackDispatcher(1)
+}
+
+// NewPoolDispatcher creates a CallbackDispatcher that runs the callbacks on up to workers goroutines, in no
+// particular order. A single worker is used when workers is lower than 1.
+func NewPoolDispatcher(workers int) *CallbackDispatcher {
+	if workers < 1 {
+		workers = 1
+	}
+	return newCallbackDispatcher(workers)
+}
+
+func newCallbackDispatcher(workers int) *CallbackDispatcher {
+	dispatcher := &CallbackDispatcher{workers: workers}
+	dispatcher.idle = sync.NewCond(&dispatcher.mutex)
+	return dispatcher
+}
+
+// SetErrorHook sets a function that is called with a CallbackPanicError when a callback panics.
+// The panics are recovered and dropped without a hook.
+func (dispatcher *CallbackDispatcher) SetErrorHook(hook func(err error)) {
+	dispatcher.mutex.Lock()
+	defer dispatcher.mutex.Unlock()
+	dispatcher.errorHook = hook
+}
+
+// SetPendingLimit bounds the callbacks waiting for a worker, 0 leaves them unbounded. The callbacks are
+// dispatched while the cache is locked, so once limit callbacks are pending the new ones are dropped
+// instead of blocking the cache, see Dropped.
+func (dispatcher *CallbackDispatcher) SetPendingLimit(limit int) {
+	dispatcher.mutex.Lock()
+	defer dispatcher.mutex.Unlock()
+	dispatcher.pendingLimit = limit
+}
+
+// Dropped returns the amount of callbacks dropped over the pending limit or after Close
+func (dispatcher *CallbackDispatcher) Dropped() int64 {
+	dispatcher.mutex.Lock()
+	defer dispatcher.mutex.Unlock()
+	return dispatcher.dropped
+}
+
+// Wait returns once the callbacks dispatched so far ran, Close of a cache calls it
+func (dispatcher *CallbackDispatcher) Wait() {
+	dispatcher.mutex.Lock()
+	defer dispatcher.mutex.Unlock()
+	for dispatcher.running > 0 {
+		dispatcher.idle.Wait()
+	}
+}
+
+// Close waits for the pending callbacks to run, the callbacks dispatched afterwards are dropped.
+// Repeated calls return ErrClosed.
+func (dispatcher *CallbackDispatcher) Close() error {
+	dispatcher.mutex.Lock()
+	defer dispatcher.mutex.Unlock()
+	if dispatcher.closed {
+		return ErrClosed
+	}
+	dispatcher.closed = true
+	for dispatcher.running > 0 {
+		dispatcher.idle.Wait()
+	}
+	return nil
+}
+
+// dispatch runs the callback or adds it to the pending ones, it never blocks on the callbacks of others
+func (dispatcher *CallbackDispatcher) dispatch(callback func()) {
+	dispatcher.mutex.Lock()
+	defer dispatcher.mutex.Unlock()
+	if dispatcher.closed || (dispatcher.pendingLimit > 0 && len(dispatcher.pending) >= dispatcher.pendingLimit) {
+		dispatcher.dropped++
+		return
+	}
+	if dispatcher.workers == 0 {
+		dispatcher.mutex.Unlock()
+		dispatcher.run(callback)
+		dispatcher.mutex.Lock()
+		return
+	}
+	dispatcher.pending = append(dispatcher.pending, callback)
+	if dispatcher.running < dispatcher.workers {
+		dispatcher.running++
+		go dispatcher.work()
+	}
+}
+
+// work runs the pending callbacks until there are none left
+func (dispatcher *CallbackDispatcher) work() {
+	dispatcher.mutex.Lock()
+	defer dispatcher.mutex.Unlock()
+	for len(dispatcher.pending) > 0 {
+		callback := dispatcher.pending[0]
+		dispatcher.pending[0] = nil
+		dispatcher.pending = dispatcher.pending[1:]
+		dispatcher.mutex.Unlock()
+		dispatcher.run(callback)
+		dispatcher.mutex.Lock()
+	}
+	dispatcher.pending = nil
+	dispatcher.running--
+	if dispatcher.running == 0 {
+		dispatcher.idle.Broadcast()
+	}
+}
+
+// run calls the callback, recovering from its panic
+func (dispatcher *CallbackDispatcher) run(callback func()) {
+	defer func() {
+		if value := recover(); value != nil {
+			dispatcher.mutex.Lock()
+			errorHook := dispatcher.errorHook
+			dispatcher.mutex.Unlock()
+			if errorHook != nil {
+				errorHook(CallbackPanicError{Value: value, Stack: debug.Stack()})
+			}
+		}
+	}()
+	callback()
+}
+
+// SetCallbackDispatcher sets the dispatcher running the expiration callbacks, see CallbackDispatcher.
+// Close waits for the callbacks of the dispatcher to run. Set to nil to run every callback in a goroutine of its own.
+func (cache *Cache[K, V]) SetCallbackDispatcher(dispatcher *CallbackDispatcher) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.callbackDispatcher = dispatcher
+}
+
+// dispatchExpirationCallback hands the expiration callbacks of an item to the dispatcher
+func (cache *Cache[K, V]) dispatchExpirationCallback(item *item[K, V], reason EvictionReason) {
+	key, data := item.key, item.data
+	if expireCallback := cache.expireCallback; expireCallback != nil && item.err == nil {
+		cache.callbackDispatcher.dispatch(func() {
+			expireCallback(key, data)
+		})
+	}
+	if expireReasonCallback := cache.expireReasonCallback; expireReasonCallback != nil {
+		cache.callbackDispatcher.dispatch(func() {
+			expireReasonCallback(key, reason, data)
+		})
+	}
+}
+
+// waitCallbacks waits for the dispatcher of the cache to run the callbacks dispatched so far
+func (cache *Cache[K, V]) waitCallbacks() {
+	cache.mutex.Lock()
+	dispatcher := cache.callbackDispatcher
+	cache.mutex.Unlock()
+	if dispatcher != nil {
+		dispatcher.Wait()
+	}
+}
@@ -0,0 +1,143 @@
+package ttl
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// EventType is the kind of change reported by an Event
+type EventType int
+
+const (
+	// EventInserted : a key was added to the cache
+	EventInserted EventType = iota
+	// EventUpdated : the value or ttl of a key in the cache was replaced
+	EventUpdated
+	// EventTouched : the ttl of a key was reset with Touch
+	EventTouched
+	// EventRemoved : a key left the cache before it expired, see the Reason
+	EventRemoved
+	// EventExpired : the ttl of a key is over
+	EventExpired
+)
+
+func (eventType EventType) String() string {
+	switch eventType {
+	case EventInserted:
+		return "Inserted"
+	case EventUpdated:
+		return "Updated"
+	case EventTouched:
+		return "Touched"
+	case EventRemoved:
+		return "Removed"
+	case EventExpired:
+		return "Expired"
+	}
+	return fmt.Sprintf("EventType(%d)", int(eventType))
+}
+
+// Event is a change of a key of the cache, delivered to the channels returned by Subscribe
+type Event[K comparable, V any] struct {
+	Type  EventType
+	Key   K
+	Value V
+	// Reason is only set for EventRemoved and EventExpired
+	Reason EvictionReason
+	Time   time.Time
+}
+
+// subscription is the channel of a subscriber, it can be shared by the shards of a ShardedCache
+type subscription[K comparable, V any] struct {
+	mutex  sync.Mutex
+	events chan Event[K, V]
+	closed bool
+}
+
+// send delivers the event without blocking, it returns false when the event was dropped
+func (subscription *subscription[K, V]) send(event Event[K, V]) bool {
+	subscription.mutex.Lock()
+	defer subscription.mutex.Unlock()
+	if subscription.closed {
+		return true
+	}
+	select {
+	case subscription.events <- event:
+		return true
+	default:
+		return false
+	}
+}
+
+func (subscription *subscription[K, V]) close() {
+	subscription.mutex.Lock()
+	defer subscription.mutex.Unlock()
+	if !subscription.closed {
+		subscription.closed = true
+		close(subscription.events)
+	}
+}
+
+// Subscribe returns a channel receiving an Event for every key that is inserted, updated, touched, removed or expired,
+// including the removals of Purge and Close, in the order the changes were made. Cached loader errors are not reported.
+// Events are sent without blocking the cache: when the buffer of the channel is full the event is dropped and counted
+// in Metrics.EventsDropped, so the buffer must be large enough for the consumer to keep up.
+// The channel is closed by cancel and by Close.
+func (cache *Cache[K, V]) Subscribe(buffer int) (<-chan Event[K, V], func()) {
+	subscription := &subscription[K, V]{events: make(chan Event[K, V], buffer)}
+	if !cache.subscribe(subscription) {
+		subscription.close()
+		return subscription.events, func() {}
+	}
+	return subscription.events, func() {
+		cache.unsubscribe(subscription)
+		subscription.close()
+	}
+}
+
+// subscribe adds a subscriber, it returns false when the cache is closed
+func (cache *Cache[K, V]) subscribe(subscription *subscription[K, V]) bool {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if cache.isShutDown {
+		return false
+	}
+	cache.subscriptions[subscription] = struct{}{}
+	return true
+}
+
+func (cache *Cache[K, V]) unsubscribe(subscription *subscription[K, V]) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	delete(cache.subscriptions, subscription)
+}
+
+// closeSubscriptions closes the channels of all the subscribers
+func (cache *Cache[K, V]) closeSubscriptions() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	for subscription := range cache.subscriptions {
+		subscription.close()
+	}
+	cache.subscriptions = make(map[*subscription[K, V]]struct{})
+}
+
+// publish sends an event about the item to the subscribers, it must be called while holding the cache lock
+func (cache *Cache[K, V]) publish(eventType EventType, item *item[K, V], reason EvictionReason) {
+	if len(cache.subscriptions) == 0 || item.err != nil {
+		return
+	}
+	event := Event[K, V]{
+		Type:   eventType,
+		Key:    item.key,
+		Value:  item.data,
+		Reason: reason,
+		Time:   cache.clock.Now(),
+	}
+	for subscription := range cache.subscriptions {
+		if !subscription.send(event) {
+			cache.metrics.EventsDropped++
+		}
+	}
+}
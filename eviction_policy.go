@@ -0,0 +1,191 @@
+package ttl
+
+import (
+	"container/list"
+)
+
+// EvictionPolicy decides which item is evicted when the cache size limit is reached.
+// The cache keeps the policy informed about every key it stores, so the policy
+// can choose a victim without looking at the expiration time of the items.
+// Methods are always called while holding the cache lock, implementations do not need
+// to be safe for concurrent use. A policy instance must not be shared between caches.
+type EvictionPolicy[K comparable] interface {
+	// Add is called when a new key is stored in the cache
+	Add(key K)
+	// Access is called when an existing key is retrieved, updated or touched
+	Access(key K)
+	// Remove is called when a key leaves the cache for any reason
+	Remove(key K)
+	// Victim returns the key that should be evicted next, false when there is none
+	Victim() (K, bool)
+	// Purge forgets about all the keys
+	Purge()
+}
+
+// LRUPolicy evicts the least recently used key.
+type LRUPolicy[K comparable] struct {
+	order   *list.List
+	entries map[K]*list.Element
+}
+
+// NewLRUPolicy creates an EvictionPolicy that evicts the least recently used key
+func NewLRUPolicy[K comparable]() *LRUPolicy[K] {
+	return &LRUPolicy[K]{
+		order:   list.New(),
+		entries: make(map[K]*list.Element),
+	}
+}
+
+// Add meets the EvictionPolicy interface
+func (p *LRUPolicy[K]) Add(key K) {
+	if element, exists := p.entries[key]; exists {
+		p.order.MoveToFront(element)
+		return
+	}
+	p.entries[key] = p.order.PushFront(key)
+}
+
+// Access meets the EvictionPolicy interface
+func (p *LRUPolicy[K]) Access(key K) {
+	if element, exists := p.entries[key]; exists {
+		p.order.MoveToFront(element)
+	}
+}
+
+// Remove meets the EvictionPolicy interface
+func (p *LRUPolicy[K]) Remove(key K) {
+	if element, exists := p.entries[key]; exists {
+		p.order.Remove(element)
+		delete(p.entries, key)
+	}
+}
+
+// Victim meets the EvictionPolicy interface
+func (p *LRUPolicy[K]) Victim() (K, bool) {
+	element := p.order.Back()
+	if element == nil {
+		var zero K
+		return zero, false
+	}
+	return element.Value.(K), true
+}
+
+// Purge meets the EvictionPolicy interface
+func (p *LRUPolicy[K]) Purge() {
+	p.order.Init()
+	p.entries = make(map[K]*list.Element)
+}
+
+// FIFOPolicy evicts the key that was added first, accesses do not change the order.
+type FIFOPolicy[K comparable] struct {
+	LRUPolicy[K]
+}
+
+// NewFIFOPolicy creates an EvictionPolicy that evicts keys in insertion order
+func NewFIFOPolicy[K comparable]() *FIFOPolicy[K] {
+	return &FIFOPolicy[K]{
+		LRUPolicy: *NewLRUPolicy[K](),
+	}
+}
+
+// Add meets the EvictionPolicy interface
+func (p *FIFOPolicy[K]) Add(key K) {
+	if _, exists := p.entries[key]; !exists {
+		p.entries[key] = p.order.PushFront(key)
+	}
+}
+
+// Access meets the EvictionPolicy interface
+func (p *FIFOPolicy[K]) Access(key K) {}
+
+// LFUPolicy evicts the least frequently used key. When several keys share
+// the lowest frequency the one that reached that frequency first is evicted.
+// All operations are O(1).
+type LFUPolicy[K comparable] struct {
+	// buckets is ordered by frequency, lowest first
+	buckets *list.List
+	entries map[K]*lfuEntry[K]
+}
+
+type lfuBucket[K comparable] struct {
+	frequency uint64
+	keys      *list.List
+}
+
+type lfuEntry[K comparable] struct {
+	bucket  *list.Element
+	element *list.Element
+}
+
+// NewLFUPolicy creates an EvictionPolicy that evicts the least frequently used key
+func NewLFUPolicy[K comparable]() *LFUPolicy[K] {
+	return &LFUPolicy[K]{
+		buckets: list.New(),
+		entries: make(map[K]*lfuEntry[K]),
+	}
+}
+
+// Add meets the EvictionPolicy interface
+func (p *LFUPolicy[K]) Add(key K) {
+	if _, exists := p.entries[key]; exists {
+		p.Access(key)
+		return
+	}
+	first := p.buckets.Front()
+	if first == nil || first.Value.(*lfuBucket[K]).frequency != 1 {
+		first = p.buckets.PushFront(&lfuBucket[K]{frequency: 1, keys: list.New()})
+	}
+	p.entries[key] = &lfuEntry[K]{
+		bucket:  first,
+		element: first.Value.(*lfuBucket[K]).keys.PushBack(key),
+	}
+}
+
+// Access meets the EvictionPolicy interface
+func (p *LFUPolicy[K]) Access(key K) {
+	entry, exists := p.entries[key]
+	if !exists {
+		return
+	}
+	current := entry.bucket.Value.(*lfuBucket[K])
+	next := entry.bucket.Next()
+	if next == nil || next.Value.(*lfuBucket[K]).frequency != current.frequency+1 {
+		next = p.buckets.InsertAfter(&lfuBucket[K]{frequency: current.frequency + 1, keys: list.New()}, entry.bucket)
+	}
+	p.unlink(entry)
+	entry.bucket = next
+	entry.element = next.Value.(*lfuBucket[K]).keys.PushBack(key)
+}
+
+// Remove meets the EvictionPolicy interface
+func (p *LFUPolicy[K]) Remove(key K) {
+	if entry, exists := p.entries[key]; exists {
+		p.unlink(entry)
+		delete(p.entries, key)
+	}
+}
+
+// Victim meets the EvictionPolicy interface
+func (p *LFUPolicy[K]) Victim() (K, bool) {
+	first := p.buckets.Front()
+	if first == nil {
+		var zero K
+		return zero, false
+	}
+	return first.Value.(*lfuBucket[K]).keys.Front().Value.(K), true
+}
+
+// Purge meets the EvictionPolicy interface
+func (p *LFUPolicy[K]) Purge() {
+	p.buckets.Init()
+	p.entries = make(map[K]*lfuEntry[K])
+}
+
+// unlink removes the entry from its bucket, dropping the bucket when it gets empty
+func (p *LFUPolicy[K]) unlink(entry *lfuEntry[K]) {
+	bucket := entry.bucket.Value.(*lfuBucket[K])
+	bucket.keys.Remove(entry.element)
+	if bucket.keys.Len() == 0 {
+		p.buckets.Remove(entry.bucket)
+	}
+}
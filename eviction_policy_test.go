@@ -0,0 +1,79 @@
+package ttl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func victim[K comparable](t *testing.T, policy EvictionPolicy[K]) K {
+	key, ok := policy.Victim()
+	assert.True(t, ok, "Expected the policy to have a victim")
+	return key
+}
+
+func TestLRUPolicy(t *testing.T) {
+	policy := NewLRUPolicy[string]()
+	_, ok := policy.Victim()
+	assert.False(t, ok, "Expected an empty policy to have no victim")
+
+	policy.Add("a")
+	policy.Add("b")
+	policy.Add("c")
+	assert.Equal(t, "a", victim[string](t, policy))
+
+	policy.Access("a")
+	assert.Equal(t, "b", victim[string](t, policy))
+
+	policy.Remove("b")
+	assert.Equal(t, "c", victim[string](t, policy))
+
+	policy.Purge()
+	_, ok = policy.Victim()
+	assert.False(t, ok, "Expected a purged policy to have no victim")
+}
+
+func TestFIFOPolicy(t *testing.T) {
+	policy := NewFIFOPolicy[string]()
+	policy.Add("a")
+	policy.Add("b")
+	policy.Access("a")
+	policy.Add("a")
+	assert.Equal(t, "a", victim[string](t, policy))
+
+	policy.Remove("a")
+	assert.Equal(t, "b", victim[string](t, policy))
+	policy.Remove("b")
+	_, ok := policy.Victim()
+	assert.False(t, ok, "Expected an empty policy to have no victim")
+}
+
+func TestLFUPolicy(t *testing.T) {
+	policy := NewLFUPolicy[string]()
+	_, ok := policy.Victim()
+	assert.False(t, ok, "Expected an empty policy to have no victim")
+
+	policy.Add("a")
+	policy.Add("b")
+	policy.Add("c")
+	policy.Access("a")
+	policy.Access("a")
+	policy.Access("b")
+	assert.Equal(t, "c", victim[string](t, policy))
+
+	policy.Remove("c")
+	assert.Equal(t, "b", victim[string](t, policy))
+
+	// b reaches the frequency of a later, so a is older within that frequency
+	policy.Access("b")
+	assert.Equal(t, "a", victim[string](t, policy))
+
+	policy.Add("d")
+	assert.Equal(t, "d", victim[string](t, policy))
+	assert.Equal(t, 3, len(policy.entries))
+	assert.Equal(t, 2, policy.buckets.Len(), "Expected empty buckets to be dropped")
+
+	policy.Purge()
+	_, ok = policy.Victim()
+	assert.False(t, ok, "Expected a purged policy to have no victim")
+}
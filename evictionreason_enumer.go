@@ -4,9 +4,9 @@ import (
 	"fmt"
 )
 
-const evictionReasonName = "RemovedEvictedSizeExpiredClosed"
+const evictionReasonName = "RemovedEvictedSizeExpiredClosedExpiredNegative"
 
-var evictionReasonIndex = [...]uint8{0, 7, 18, 25, 31}
+var evictionReasonIndex = [...]uint8{0, 7, 18, 25, 31, 46}
 
 func (i EvictionReason) String() string {
 	if i < 0 || i >= EvictionReason(len(evictionReasonIndex)-1) {
@@ -15,13 +15,14 @@ func (i EvictionReason) String() string {
 	return evictionReasonName[evictionReasonIndex[i]:evictionReasonIndex[i+1]]
 }
 
-var evictionReasonValues = []EvictionReason{0, 1, 2, 3}
+var evictionReasonValues = []EvictionReason{0, 1, 2, 3, 4}
 
 var evictionReasonNameToValueMap = map[string]EvictionReason{
 	evictionReasonName[0:7]:   0,
 	evictionReasonName[7:18]:  1,
 	evictionReasonName[18:25]: 2,
 	evictionReasonName[25:31]: 3,
+	evictionReasonName[31:46]: 4,
 }
 
 // EvictionReasonString retrieves an enum value from the enum constants string name.
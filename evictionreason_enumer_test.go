@@ -14,6 +14,7 @@ func TestError(t *testing.T) {
 func TestEvictionError(t *testing.T) {
 	assert.Equal(t, "Removed", Removed.String())
 	assert.Equal(t, "Expired", Expired.String())
+	assert.Equal(t, "ExpiredNegative", ExpiredNegative.String())
 	assert.Equal(t, "EvictionReason(50)", EvictionReason(50).String())
 }
 
@@ -30,10 +31,11 @@ func TestIsAEvictionReson(t *testing.T) {
 	assert.True(t, Removed.IsAEvictionReason())
 	assert.True(t, EvictedSize.IsAEvictionReason())
 	assert.True(t, Expired.IsAEvictionReason())
+	assert.True(t, ExpiredNegative.IsAEvictionReason())
 	assert.False(t, EvictionReason(50).IsAEvictionReason())
 }
 
 func TestGetEvictionResonValues(t *testing.T) {
 	assert.NotEmpty(t, EvictionReasonValues())
-	assert.Equal(t, len(EvictionReasonValues()), 4)
+	assert.Equal(t, len(EvictionReasonValues()), 5)
 }
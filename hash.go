@@ -0,0 +1,124 @@
+package ttl
+
+import (
+	"math"
+	"reflect"
+)
+
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+// hashKey returns a 64 bit hash of a cache key, keys that are equal under == have the same hash.
+// Strings, numbers and booleans are hashed without reflection, other key types are walked with reflect.
+func hashKey[K comparable](key K) uint64 {
+	switch k := any(key).(type) {
+	case string:
+		return hashString(k)
+	case int:
+		return mix64(uint64(k))
+	case int8:
+		return mix64(uint64(k))
+	case int16:
+		return mix64(uint64(k))
+	case int32:
+		return mix64(uint64(k))
+	case int64:
+		return mix64(uint64(k))
+	case uint:
+		return mix64(uint64(k))
+	case uint8:
+		return mix64(uint64(k))
+	case uint16:
+		return mix64(uint64(k))
+	case uint32:
+		return mix64(uint64(k))
+	case uint64:
+		return mix64(k)
+	case uintptr:
+		return mix64(uint64(k))
+	case float32:
+		return hashFloat(float64(k))
+	case float64:
+		return hashFloat(k)
+	case bool:
+		return hashBool(k)
+	}
+	return hashValue(fnvOffset64, reflect.ValueOf(key))
+}
+
+// hashValue adds the hash of v to hash, it follows the rules of == for every comparable kind:
+// the fields of structs and the elements of arrays are hashed one by one, pointers and channels
+// by their address and interfaces by their dynamic value.
+func hashValue(hash uint64, v reflect.Value) uint64 {
+	var h uint64
+	switch v.Kind() {
+	case reflect.String:
+		h = hashString(v.String())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		h = mix64(uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		h = mix64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		h = hashFloat(v.Float())
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		h = hashFloat(real(c)) ^ mix64(hashFloat(imag(c)))
+	case reflect.Bool:
+		h = hashBool(v.Bool())
+	case reflect.Ptr, reflect.Chan, reflect.UnsafePointer:
+		h = mix64(uint64(v.Pointer()))
+	case reflect.Interface:
+		if v.IsNil() {
+			return mix64(hash)
+		}
+		return hashValue(hash, v.Elem())
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			hash = hashValue(hash, v.Index(i))
+		}
+		return hash
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			hash = hashValue(hash, v.Field(i))
+		}
+		return hash
+	}
+	return mix64(hash ^ h)
+}
+
+// hashFloat hashes a float so that 0 and -0 agree, NaN is never equal to a key and can hash to anything
+func hashFloat(f float64) uint64 {
+	if f == 0 {
+		f = 0
+	}
+	return mix64(math.Float64bits(f))
+}
+
+func hashBool(b bool) uint64 {
+	if b {
+		return mix64(1)
+	}
+	return mix64(0)
+}
+
+// hashString is the FNV-1a hash of s
+func hashString(s string) uint64 {
+	hash := uint64(fnvOffset64)
+	for i := 0; i < len(s); i++ {
+		hash ^= uint64(s[i])
+		hash *= fnvPrime64
+	}
+	return hash
+}
+
+// mix64 is the splitmix64 finalizer, it spreads sequential integers over all the bits
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,97 @@
+package ttl
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// histogramBounds are the upper bounds of the buckets of a Histogram, from 1µs to 10s
+var histogramBounds = [...]time.Duration{
+	time.Microsecond, 2500 * time.Nanosecond, 5 * time.Microsecond,
+	10 * time.Microsecond, 25 * time.Microsecond, 50 * time.Microsecond,
+	100 * time.Microsecond, 250 * time.Microsecond, 500 * time.Microsecond,
+	time.Millisecond, 2500 * time.Microsecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second,
+	10 * time.Second,
+}
+
+// Histogram counts durations in buckets, see Bounds
+type Histogram struct {
+	// Counts holds the amount of durations per bucket, the last bucket counts the durations above all the bounds
+	Counts [len(histogramBounds) + 1]int64
+	// Count is the amount of durations
+	Count int64
+	// Sum is the total of the durations
+	Sum time.Duration
+}
+
+// Bounds returns the upper bound, inclusive, of each bucket of Counts but the last one
+func (histogram Histogram) Bounds() []time.Duration {
+	return append([]time.Duration(nil), histogramBounds[:]...)
+}
+
+// Quantile estimates the duration under which the fraction q, between 0 and 1, of the durations fall.
+// It is the upper bound of the bucket the quantile falls in, or the highest bound for the last bucket.
+func (histogram Histogram) Quantile(q float64) time.Duration {
+	if histogram.Count == 0 {
+		return 0
+	}
+	rank := int64(q*float64(histogram.Count) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, count := range histogram.Counts[:len(histogramBounds)] {
+		seen += count
+		if seen >= rank {
+			return histogramBounds[i]
+		}
+	}
+	return histogramBounds[len(histogramBounds)-1]
+}
+
+// add sums the durations of other into histogram
+func (histogram *Histogram) add(other Histogram) {
+	for i, count := range other.Counts {
+		histogram.Counts[i] += count
+	}
+	histogram.Count += other.Count
+	histogram.Sum += other.Sum
+}
+
+// latencyHistogram is the concurrent version of Histogram, durations are observed without holding the cache lock
+type latencyHistogram struct {
+	counts [len(histogramBounds) + 1]int64
+	sum    int64
+}
+
+// observe adds the time since start to the histogram
+func (histogram *latencyHistogram) observe(start time.Time) {
+	histogram.record(time.Since(start))
+}
+
+// record adds a duration to the histogram
+func (histogram *latencyHistogram) record(duration time.Duration) {
+	bucket := len(histogramBounds)
+	for i, bound := range histogramBounds {
+		if duration <= bound {
+			bucket = i
+			break
+		}
+	}
+	atomic.AddInt64(&histogram.counts[bucket], 1)
+	atomic.AddInt64(&histogram.sum, int64(duration))
+}
+
+// snapshot returns a copy of the histogram
+func (histogram *latencyHistogram) snapshot() Histogram {
+	var result Histogram
+	for i := range histogram.counts {
+		result.Counts[i] = atomic.LoadInt64(&histogram.counts[i])
+		result.Count += result.Counts[i]
+	}
+	result.Sum = time.Duration(atomic.LoadInt64(&histogram.sum))
+	return result
+}
@@ -0,0 +1,35 @@
+package ttl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogram(t *testing.T) {
+	latency := &latencyHistogram{}
+	latency.record(time.Microsecond)
+	latency.record(3 * time.Microsecond)
+	latency.record(2 * time.Millisecond)
+	latency.record(time.Minute)
+
+	histogram := latency.snapshot()
+	bounds := histogram.Bounds()
+	assert.Len(t, histogram.Counts, len(bounds)+1)
+	assert.Equal(t, int64(4), histogram.Count)
+	assert.Equal(t, time.Minute+2*time.Millisecond+4*time.Microsecond, histogram.Sum)
+	assert.Equal(t, int64(1), histogram.Counts[0], "Expected bounds to be inclusive")
+	assert.Equal(t, int64(1), histogram.Counts[2])
+	assert.Equal(t, int64(1), histogram.Counts[len(bounds)], "Expected long durations in the last bucket")
+
+	assert.Equal(t, time.Microsecond, histogram.Quantile(0))
+	assert.Equal(t, 5*time.Microsecond, histogram.Quantile(0.5))
+	assert.Equal(t, 2500*time.Microsecond, histogram.Quantile(0.75))
+	assert.Equal(t, 10*time.Second, histogram.Quantile(1))
+	assert.Equal(t, time.Duration(0), Histogram{}.Quantile(0.5))
+
+	histogram.add(histogram)
+	assert.Equal(t, int64(8), histogram.Count)
+	assert.Equal(t, int64(2), histogram.Counts[0])
+}
@@ -11,51 +11,95 @@ const (
 	ItemExpireWithGlobalTTL time.Duration = 0
 )
 
-func newItem(key string, data interface{}, ttl time.Duration) *item {
-	item := &item{
+func newItem[K comparable, V any](key K, data V, ttl time.Duration, now time.Time) *item[K, V] {
+	item := &item[K, V]{
 		data: data,
 		ttl:  ttl,
 		key:  key,
 	}
 	// since nobody is aware yet of this item, it's safe to touch without lock here
-	item.touch()
+	item.touch(now)
 	return item
 }
 
-type item struct {
-	key        string
-	data       interface{}
+type item[K comparable, V any] struct {
+	key        K
+	data       V
 	ttl        time.Duration
 	expireAt   time.Time
 	queueIndex int
+	cost       int64
+	// how long the item stays in the cache, as stale, once its ttl is over
+	stale time.Duration
+	// fraction of the ttl after which the item is refreshed by the loader
+	refreshAhead float64
+	refreshAt    time.Time
+	// error returned by the loader, cached instead of data
+	err error
+	// version is increased on every change of the data or ttl of the item
+	version uint64
+	tags    []string
 }
 
 // Reset the item expiration time
-func (item *item) touch() {
+func (item *item[K, V]) touch(now time.Time) {
 	if item.ttl > 0 {
-		item.expireAt = time.Now().Add(item.ttl)
+		item.setExpireAt(now.Add(item.ttl))
 	}
 }
 
-// expired verify if the item is expired
-func (item *item) expired() bool {
+// setExpireAt sets the expiration time of the item, the refresh time follows from it
+func (item *item[K, V]) setExpireAt(expireAt time.Time) {
+	item.expireAt = expireAt
+	item.refreshAt = time.Time{}
+	if item.refreshAhead > 0 {
+		item.refreshAt = expireAt.Add(-time.Duration(float64(item.ttl) * (1 - item.refreshAhead)))
+	}
+}
+
+// expired verify if the item is expired at now, including its stale window
+func (item *item[K, V]) expired(now time.Time) bool {
 	if item.ttl <= 0 {
 		return false
 	}
-	return item.expireAt.Before(time.Now())
+	return !item.removeAt().After(now)
 }
 
-// ExpiresAt meets the ExpirationHeapEntry interface
-func (item *item) ExpiresAt() time.Time {
+// refreshDue verify if the item has to be refreshed ahead of its expiration
+func (item *item[K, V]) refreshDue(now time.Time) bool {
+	return !item.refreshAt.IsZero() && !item.refreshAt.After(now)
+}
+
+// isStale verify if the ttl of the item is over but it is still within its stale window
+func (item *item[K, V]) isStale(now time.Time) bool {
+	if item.ttl <= 0 || item.stale <= 0 {
+		return false
+	}
+	return !item.expireAt.After(now)
+}
+
+// removeAt is the time when the item has to be removed from the cache
+func (item *item[K, V]) removeAt() time.Time {
+	if item.stale > 0 && !item.expireAt.IsZero() {
+		return item.expireAt.Add(item.stale)
+	}
 	return item.expireAt
 }
 
+// ExpiresAt meets the ExpirationHeapEntry interface, the item is due either to be refreshed or removed
+func (item *item[K, V]) ExpiresAt() time.Time {
+	if !item.refreshAt.IsZero() {
+		return item.refreshAt
+	}
+	return item.removeAt()
+}
+
 // SetIndex meets the ExpirationHeapEntry interface
-func (item *item) SetIndex(index int) {
+func (item *item[K, V]) SetIndex(index int) {
 	item.queueIndex = index
 }
 
 // GetIndex meets the ExpirationHeapEntry interface
-func (item *item) GetIndex() int {
+func (item *item[K, V]) GetIndex() int {
 	return item.queueIndex
 }
@@ -8,27 +8,27 @@ import (
 )
 
 func TestItemExpired(t *testing.T) {
-	item := newItem("key", "value", (time.Duration(100) * time.Millisecond))
-	assert.Equal(t, item.expired(), false, "Expected item to not be expired")
+	item := newItem("key", "value", (time.Duration(100) * time.Millisecond), time.Now())
+	assert.Equal(t, item.expired(time.Now()), false, "Expected item to not be expired")
 	<-time.After(200 * time.Millisecond)
-	assert.Equal(t, item.expired(), true, "Expected item to be expired once time has passed")
+	assert.Equal(t, item.expired(time.Now()), true, "Expected item to be expired once time has passed")
 }
 
 func TestItemTouch(t *testing.T) {
-	item := newItem("key", "value", (time.Duration(100) * time.Millisecond))
+	item := newItem("key", "value", (time.Duration(100) * time.Millisecond), time.Now())
 	oldExpireAt := item.expireAt
 	<-time.After(50 * time.Millisecond)
-	item.touch()
+	item.touch(time.Now())
 	assert.NotEqual(t, oldExpireAt, item.expireAt, "Expected dates to be different")
 	<-time.After(150 * time.Millisecond)
-	assert.Equal(t, item.expired(), true, "Expected item to be expired")
-	item.touch()
+	assert.Equal(t, item.expired(time.Now()), true, "Expected item to be expired")
+	item.touch(time.Now())
 	<-time.After(50 * time.Millisecond)
-	assert.Equal(t, item.expired(), false, "Expected item to not be expired")
+	assert.Equal(t, item.expired(time.Now()), false, "Expected item to not be expired")
 }
 
 func TestItemWithoutExpiration(t *testing.T) {
-	item := newItem("key", "value", ItemNotExpire)
+	item := newItem("key", "value", ItemNotExpire, time.Now())
 	<-time.After(50 * time.Millisecond)
-	assert.Equal(t, item.expired(), false, "Expected item to not be expired")
+	assert.Equal(t, item.expired(time.Now()), false, "Expected item to not be expired")
 }
@@ -0,0 +1,26 @@
+//go:build go1.23
+
+package ttl
+
+import (
+	"iter"
+	"time"
+)
+
+// All returns an iterator over the keys and values of the cache, see Range
+func (cache *Cache[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		cache.Range(func(key K, value V, expiresAt time.Time) bool {
+			return yield(key, value)
+		})
+	}
+}
+
+// All returns an iterator over the keys and values of the cache, see Range
+func (cache *ShardedCache[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		cache.Range(func(key K, value V, expiresAt time.Time) bool {
+			return yield(key, value)
+		})
+	}
+}
@@ -0,0 +1,37 @@
+//go:build go1.23
+
+package ttl_test
+
+import (
+	"testing"
+
+	. "github.com/asgarciap/ttl/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache_All(t *testing.T) {
+	t.Parallel()
+	cache := NewCache[string, int]()
+	defer cache.Close()
+	sharded := NewShardedCache[string, int](4)
+	defer sharded.Close()
+
+	for i, key := range []string{"a", "b", "c"} {
+		cache.Set(key, i)
+		sharded.Set(key, i)
+	}
+	for _, all := range []func(yield func(string, int) bool){cache.All(), sharded.All()} {
+		items := map[string]int{}
+		for key, value := range all {
+			items[key] = value
+		}
+		assert.Equal(t, map[string]int{"a": 0, "b": 1, "c": 2}, items)
+
+		count := 0
+		for range all {
+			count++
+			break
+		}
+		assert.Equal(t, 1, count)
+	}
+}
@@ -0,0 +1,232 @@
+package ttl
+
+import (
+	"sync"
+	"time"
+)
+
+// Janitor expires the items of many caches with a single goroutine, instead of a goroutine per cache.
+// A cache is registered with the janitor when it is created with the WithJanitor option, and deregistered
+// when it is closed. The janitor keeps the caches ordered by when they have items due in an ExpirationHeap.
+type Janitor struct {
+	mutex     sync.Mutex
+	clock     Clock
+	deadlines *ExpirationHeap
+	// notified holds the caches that changed since they were run, their deadline has to be recalculated
+	notified       []*janitorEntry
+	signal         *expirationSignal
+	shutdownSignal chan (chan struct{})
+	isShutDown     bool
+}
+
+// JanitorOption configures a Janitor when it is created, see NewJanitor
+type JanitorOption func(janitor *Janitor)
+
+// WithJanitorClock sets the clock the janitor tells the deadlines of the caches with, the time package by default.
+// The caches created WithJanitor get the clock of the janitor unless they are given one WithClock, the janitor and
+// its caches have to use the same clock.
+func WithJanitorClock(clock Clock) JanitorOption {
+	return func(janitor *Janitor) {
+		if clock != nil {
+			janitor.clock = clock
+		}
+	}
+}
+
+// janitorCache is what a janitor needs of a cache
+type janitorCache interface {
+	// runJanitor expires the items that are due when expire is set, then returns how long until the
+	// cache has to be run again, false when the cache is closed
+	runJanitor(expire bool) (time.Duration, bool)
+	// stopJanitor is called when the janitor is closed, the cache has to expire its items by itself from then on
+	stopJanitor()
+}
+
+// janitorEntry is a cache in the deadlines of a janitor
+type janitorEntry struct {
+	janitor   *Janitor
+	cache     janitorCache
+	expiresAt time.Time
+	index     int
+	notified  bool
+	due       bool
+	removed   bool
+}
+
+// ExpiresAt meets the ExpirationHeapEntry interface
+func (entry *janitorEntry) ExpiresAt() time.Time {
+	return entry.expiresAt
+}
+
+// SetIndex meets the ExpirationHeapEntry interface
+func (entry *janitorEntry) SetIndex(index int) {
+	entry.index = index
+}
+
+// GetIndex meets the ExpirationHeapEntry interface
+func (entry *janitorEntry) GetIndex() int {
+	return entry.index
+}
+
+// NewJanitor creates a Janitor configured by the options and starts its goroutine, Close stops it
+func NewJanitor(opts ...JanitorOption) *Janitor {
+	janitor := &Janitor{
+		clock:          realClock{},
+		deadlines:      NewExpirationHeap(),
+		signal:         newExpirationSignal(),
+		shutdownSignal: make(chan chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(janitor)
+	}
+	janitor.signal.start(janitor.clock)
+	go janitor.run()
+	return janitor
+}
+
+// Close stops the goroutine of the janitor. The caches still registered expire their items lazily
+// from then on, as a cache created by NewManualCache does. Returns ErrClosed when already closed.
+func (janitor *Janitor) Close() error {
+	janitor.mutex.Lock()
+	if janitor.isShutDown {
+		janitor.mutex.Unlock()
+		return ErrClosed
+	}
+	janitor.isShutDown = true
+	janitor.mutex.Unlock()
+	feedback := make(chan struct{})
+	janitor.shutdownSignal <- feedback
+	<-feedback
+
+	janitor.mutex.Lock()
+	entries := make([]*janitorEntry, 0, janitor.deadlines.Len()+len(janitor.notified))
+	for janitor.deadlines.Len() > 0 {
+		entries = append(entries, janitor.deadlines.First().(*janitorEntry))
+	}
+	entries = append(entries, janitor.notified...)
+	janitor.notified = nil
+	for _, entry := range entries {
+		entry.removed = true
+	}
+	janitor.mutex.Unlock()
+	// the caches are not locked while the janitor is, they can notify it meanwhile
+	for _, entry := range entries {
+		entry.cache.stopJanitor()
+	}
+	return nil
+}
+
+// register adds a cache to the janitor, it is run right away to get its deadline.
+// Returns nil when the janitor is closed.
+func (janitor *Janitor) register(cache janitorCache) *janitorEntry {
+	janitor.mutex.Lock()
+	defer janitor.mutex.Unlock()
+	if janitor.isShutDown {
+		return nil
+	}
+	entry := &janitorEntry{janitor: janitor, cache: cache, index: EntryNotIndexed}
+	janitor.notifyLocked(entry)
+	return entry
+}
+
+// deregister removes a cache from the janitor
+func (entry *janitorEntry) deregister() {
+	janitor := entry.janitor
+	janitor.mutex.Lock()
+	defer janitor.mutex.Unlock()
+	entry.removed = true
+	janitor.deadlines.Remove(entry)
+}
+
+// notify tells the janitor to recalculate the deadline of the cache
+func (entry *janitorEntry) notify() {
+	entry.janitor.mutex.Lock()
+	defer entry.janitor.mutex.Unlock()
+	entry.janitor.notifyLocked(entry)
+}
+
+func (janitor *Janitor) notifyLocked(entry *janitorEntry) {
+	if entry.removed || entry.notified {
+		return
+	}
+	entry.notified = true
+	janitor.notified = append(janitor.notified, entry)
+	janitor.signal.notify()
+}
+
+func (janitor *Janitor) run() {
+	for {
+		timer := janitor.signal.current()
+		janitor.mutex.Lock()
+		sleepTime := time.Hour
+		if next := janitor.deadlines.NextExpiration(); !next.IsZero() {
+			sleepTime = min(next.Sub(janitor.clock.Now()), sleepTime)
+		}
+		janitor.mutex.Unlock()
+		if sleepTime < 0 {
+			sleepTime = 0
+		}
+		janitor.signal.reset(timer, sleepTime)
+		select {
+		case shutdownFeedback := <-janitor.shutdownSignal:
+			janitor.signal.stop()
+			shutdownFeedback <- struct{}{}
+			return
+		case <-timer.C():
+		case <-janitor.signal.notification:
+		}
+		janitor.runDue()
+	}
+}
+
+// runDue runs the caches that are due or were notified. The janitor is not locked while a
+// cache is run, so that the cache can notify it meanwhile.
+func (janitor *Janitor) runDue() {
+	janitor.mutex.Lock()
+	entries := janitor.notified
+	janitor.notified = nil
+	for _, entry := range entries {
+		entry.notified = false
+		janitor.deadlines.Remove(entry)
+	}
+	now := janitor.clock.Now()
+	for next := janitor.deadlines.Peek(); next != nil && !next.ExpiresAt().After(now); next = janitor.deadlines.Peek() {
+		entry := janitor.deadlines.First().(*janitorEntry)
+		entry.due = true
+		entries = append(entries, entry)
+	}
+	janitor.mutex.Unlock()
+
+	for _, entry := range entries {
+		sleepTime, open := entry.cache.runJanitor(entry.due)
+		janitor.mutex.Lock()
+		entry.due = false
+		if open && !entry.removed {
+			entry.expiresAt = janitor.clock.Now().Add(sleepTime)
+			janitor.deadlines.Add(entry)
+		}
+		janitor.mutex.Unlock()
+	}
+}
+
+// runJanitor meets the janitorCache interface
+func (cache *Cache[K, V]) runJanitor(expire bool) (time.Duration, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if cache.isShutDown {
+		return 0, false
+	}
+	if expire && cache.expirationQueue.Len() > 0 {
+		cache.cleanjob()
+	}
+	sleepTime := cache.nextExpiration()
+	cache.expirationTime = cache.clock.Now().Add(sleepTime)
+	return sleepTime, true
+}
+
+// stopJanitor meets the janitorCache interface
+func (cache *Cache[K, V]) stopJanitor() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.manual = true
+}
@@ -0,0 +1,62 @@
+package ttl
+
+import (
+	"context"
+	"time"
+)
+
+// loaderResult is the outcome of a load, shared with all the callers of the key
+type loaderResult[V any] struct {
+	data V
+	ttl  time.Duration
+	err  error
+}
+
+// loaderCall is a load in progress, the callers missing its key meanwhile wait for it instead of
+// calling the loader again. The calls are kept by key so that no two keys share a load.
+type loaderCall[V any] struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	waiters int
+	// done is closed once the result is set
+	done   chan struct{}
+	result loaderResult[V]
+}
+
+func newLoaderCall[V any](ctx context.Context) *loaderCall[V] {
+	loadCtx, cancel := context.WithCancel(detachedContext{parent: ctx})
+	return &loaderCall[V]{
+		ctx:    loadCtx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+}
+
+// detachedContext keeps the values of its parent but not its deadline or cancellation,
+// a load shared by several callers must not end when the caller that started it goes away.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (deadline time.Time, ok bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (ctx detachedContext) Value(key interface{}) interface{} {
+	return ctx.parent.Value(key)
+}
+
+// withoutContext adapts a LoaderFunction to a LoaderFunctionContext
+func withoutContext[K comparable, V any](loader LoaderFunction[K, V]) LoaderFunctionContext[K, V] {
+	return func(ctx context.Context, key K) (V, time.Duration, error) {
+		return loader(key)
+	}
+}
@@ -0,0 +1,49 @@
+package ttl
+
+import (
+	"time"
+)
+
+// NewManualCache creates a Cache without an expiration goroutine, for short-lived caches that are created
+// in large numbers. The items that are due expire lazily when the cache is accessed, or when ExpireNow or
+// Tick are called, with the same callbacks and events as the expiration goroutine of NewCache.
+func NewManualCache[K comparable, V any]() *Cache[K, V] {
+	cache := newCache[K, V](newExpirationSignal())
+	cache.manual = true
+	return cache
+}
+
+// ExpireNow expires the items that are due, as the expiration goroutine does once they are.
+// It can be called on any cache, it is how the items of a cache created by NewManualCache expire
+// besides being accessed.
+func (cache *Cache[K, V]) ExpireNow() error {
+	_, err := cache.Tick()
+	return err
+}
+
+// Tick expires the items that are due as ExpireNow, then returns how long until the next item is due,
+// or zero when none of the items expire. It lets a caller schedule the expiration of a manual cache.
+func (cache *Cache[K, V]) Tick() (time.Duration, error) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if cache.isShutDown {
+		return 0, ErrClosed
+	}
+	cache.cleanjob()
+	next := cache.expirationQueue.NextExpiration()
+	if next.IsZero() {
+		return 0, nil
+	}
+	// zero is kept for a cache without items that expire
+	if wait := next.Sub(cache.clock.Now()); wait > 0 {
+		return wait, nil
+	}
+	return time.Nanosecond, nil
+}
+
+// expireLazily expires the items that are due when the cache has no expiration goroutine, on every access
+func (cache *Cache[K, V]) expireLazily() {
+	if cache.manual && cache.expirationQueue.Len() > 0 {
+		cache.cleanjob()
+	}
+}
@@ -16,4 +16,60 @@ type Metrics struct {
 	EvictedExpired int64
 	// items removed from the cache due to a close call
 	EvictedClosed int64
+	// items removed from the cache with Remove
+	Removed int64
+	// stale items returned while being refreshed
+	StaleRetrievals int64
+	// items refreshed in the background by the loader
+	Refreshed int64
+	// background refreshes that failed, the item kept its value
+	RefreshFailed int64
+	// loader errors added to the cache
+	NegativeInserted int64
+	// get calls that returned a cached loader error
+	NegativeHits int64
+	// cached loader errors removed from the cache due to expiration
+	EvictedNegative int64
+	// total cost of the items in the cache at the moment of the snapshot
+	Cost int64
+	// loader calls that returned data, including background refreshes
+	LoaderSuccesses int64
+	// loader calls that returned an error, including background refreshes
+	LoaderFailures int64
+	// get calls that waited for a load started by another call instead of calling the loader
+	LoaderDeduplicated int64
+	// duration of the loader calls, its Sum is the total time spent loading
+	LoaderLatency Histogram
+	// duration of the get calls, including the time spent waiting for the loader
+	GetLatency Histogram
+	// duration of the set calls
+	SetLatency Histogram
+	// events not delivered because the channel of a subscriber was full
+	EventsDropped int64
+}
+
+// add sums the metrics of other into metrics
+func (metrics *Metrics) add(other Metrics) {
+	metrics.Inserted += other.Inserted
+	metrics.Retrievals += other.Retrievals
+	metrics.Hits += other.Hits
+	metrics.Misses += other.Misses
+	metrics.EvictedFull += other.EvictedFull
+	metrics.EvictedExpired += other.EvictedExpired
+	metrics.EvictedClosed += other.EvictedClosed
+	metrics.Removed += other.Removed
+	metrics.StaleRetrievals += other.StaleRetrievals
+	metrics.Refreshed += other.Refreshed
+	metrics.RefreshFailed += other.RefreshFailed
+	metrics.NegativeInserted += other.NegativeInserted
+	metrics.NegativeHits += other.NegativeHits
+	metrics.EvictedNegative += other.EvictedNegative
+	metrics.Cost += other.Cost
+	metrics.LoaderSuccesses += other.LoaderSuccesses
+	metrics.LoaderFailures += other.LoaderFailures
+	metrics.LoaderDeduplicated += other.LoaderDeduplicated
+	metrics.LoaderLatency.add(other.LoaderLatency)
+	metrics.GetLatency.add(other.GetLatency)
+	metrics.SetLatency.add(other.SetLatency)
+	metrics.EventsDropped += other.EventsDropped
 }
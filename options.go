@@ -0,0 +1,347 @@
+package ttl
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Option configures a cache when it is created, see NewCacheWithOptions. The options that take functions get
+// the key and value types from them, WithEvictionPolicy takes the key type explicitly. The types have to be the
+// ones of the cache, NewCacheWithOptions returns an OptionError for an option of other types.
+type Option func(*options) error
+
+type options struct {
+	ttl                time.Duration
+	sizeLimit          int
+	maxCost            int64
+	skipTTLExtension   bool
+	staleTTL           time.Duration
+	refreshAhead       float64
+	negativeTTL        time.Duration
+	negativeFilter     func(err error) bool
+	clock              Clock
+	newExpirationQueue func() ExpirationQueue
+	janitor            *Janitor
+	manual             bool
+	callbackDispatcher *CallbackDispatcher
+	// typed holds the options that need the types of the cache, they fail for a cache of other types
+	typed []func(cache any) error
+}
+
+// OptionError is returned by NewCacheWithOptions for an option that is invalid, alone or with the other options
+type OptionError struct {
+	// Option is the name of the invalid option, such as WithTTL
+	Option string
+	Reason string
+}
+
+func (err OptionError) Error() string {
+	return fmt.Sprintf("%s: %s %s", ErrInvalidOption, err.Option, err.Reason)
+}
+
+// Is makes errors.Is(err, ErrInvalidOption) true
+func (err OptionError) Is(target error) bool {
+	return target == ErrInvalidOption
+}
+
+// NewCacheWithOptions creates a Cache configured by the options before its expiration starts, so that no item
+// is added, expired or missed by a callback with the default settings. It returns an OptionError when an
+// option is invalid, alone or combined with the others.
+func NewCacheWithOptions[K comparable, V any](opts ...Option) (*Cache[K, V], error) {
+	var config options
+	for _, opt := range opts {
+		if err := opt(&config); err != nil {
+			return nil, err
+		}
+	}
+	cache := newCache[K, V](newExpirationSignal())
+	for _, configure := range config.typed {
+		if err := configure(cache); err != nil {
+			return nil, err
+		}
+	}
+	if err := cache.validate(&config); err != nil {
+		return nil, err
+	}
+	cache.ttl = config.ttl
+	cache.sizeLimit = config.sizeLimit
+	cache.maxCost = config.maxCost
+	cache.skipTTLExtension = config.skipTTLExtension
+	cache.staleTTL = config.staleTTL
+	cache.refreshAhead = config.refreshAhead
+	cache.negativeTTL = config.negativeTTL
+	cache.negativeFilter = config.negativeFilter
+	cache.callbackDispatcher = config.callbackDispatcher
+	if config.clock != nil {
+		cache.clock = config.clock
+	} else if config.janitor != nil {
+		cache.clock = config.janitor.clock
+	}
+	if config.newExpirationQueue != nil {
+		cache.newExpirationQueue = config.newExpirationQueue
+		cache.expirationQueue = cache.startExpirationQueue(config.newExpirationQueue)
+	}
+
+	switch {
+	case config.manual:
+		cache.manual = true
+	case config.janitor != nil:
+		cache.mutex.Lock()
+		defer cache.mutex.Unlock()
+		cache.janitor = config.janitor.register(cache)
+		// a closed janitor leaves the cache to expire its items by itself
+		cache.manual = cache.janitor == nil
+	default:
+		cache.expirationNotification.start(cache.clock)
+		go cache.startExpirationProcessing()
+	}
+	return cache, nil
+}
+
+// validate checks the combinations of options, the cache is configured by the typed options
+func (cache *Cache[K, V]) validate(config *options) error {
+	switch {
+	case config.janitor != nil && config.manual:
+		return OptionError{"WithJanitor", "can not be combined with WithManualExpiration"}
+	case config.staleTTL > 0 && cache.loaderFunction == nil:
+		return OptionError{"WithStaleWhileRevalidate", "needs a loader to refresh the stale items"}
+	case config.refreshAhead > 0 && cache.loaderFunction == nil:
+		return OptionError{"WithRefreshAhead", "needs a loader to refresh the items"}
+	case config.negativeTTL > 0 && cache.loaderFunction == nil && cache.batchLoaderFunction == nil:
+		return OptionError{"WithNegativeCaching", "needs a loader to cache its errors"}
+	case cache.weigher != nil && config.maxCost == 0:
+		return OptionError{"WithWeigher", "needs WithMaxCost, the costs are not used otherwise"}
+	case cache.evictionPolicy != nil && config.sizeLimit == 0 && config.maxCost == 0:
+		return OptionError{"WithEvictionPolicy", "needs WithSizeLimit or WithMaxCost, nothing is evicted otherwise"}
+	}
+	return nil
+}
+
+// WithTTL sets the global TTL of the cache, see SetTTL
+func WithTTL(ttl time.Duration) Option {
+	return func(options *options) error {
+		if ttl < 0 {
+			return OptionError{"WithTTL", "can not be negative"}
+		}
+		options.ttl = ttl
+		return nil
+	}
+}
+
+// WithSizeLimit sets the limit to the amount of cached items, see SetCacheSizeLimit
+func WithSizeLimit(limit int) Option {
+	return func(options *options) error {
+		if limit < 0 {
+			return OptionError{"WithSizeLimit", "can not be negative"}
+		}
+		options.sizeLimit = limit
+		return nil
+	}
+}
+
+// WithMaxCost sets the limit to the total cost of the cached items, see SetMaxCost
+func WithMaxCost(maxCost int64) Option {
+	return func(options *options) error {
+		if maxCost < 0 {
+			return OptionError{"WithMaxCost", "can not be negative"}
+		}
+		options.maxCost = maxCost
+		return nil
+	}
+}
+
+// WithSkipTTLExtension stops extending the TTL of items when they are retrieved, see SkipTTLExtensionOnHit
+func WithSkipTTLExtension() Option {
+	return func(options *options) error {
+		options.skipTTLExtension = true
+		return nil
+	}
+}
+
+// WithStaleWhileRevalidate keeps items for the window once their TTL is over, see SetStaleWhileRevalidate
+func WithStaleWhileRevalidate(window time.Duration) Option {
+	return func(options *options) error {
+		if window < 0 {
+			return OptionError{"WithStaleWhileRevalidate", "can not be negative"}
+		}
+		options.staleTTL = window
+		return nil
+	}
+}
+
+// WithRefreshAhead refreshes items once the fraction of their TTL is over, see SetRefreshAhead
+func WithRefreshAhead(fraction float64) Option {
+	return func(options *options) error {
+		if validRefreshAhead(fraction) == 0 {
+			return OptionError{"WithRefreshAhead", "has to be between 0 and 1"}
+		}
+		options.refreshAhead = fraction
+		return nil
+	}
+}
+
+// WithNegativeCaching caches the errors of the loader accepted by the filter for ttl, see SetNegativeCaching
+func WithNegativeCaching(ttl time.Duration, filter func(err error) bool) Option {
+	return func(options *options) error {
+		if ttl <= 0 {
+			return OptionError{"WithNegativeCaching", "needs a positive ttl"}
+		}
+		options.negativeTTL = ttl
+		options.negativeFilter = filter
+		return nil
+	}
+}
+
+// WithClock sets the clock of the cache, see SetClock
+func WithClock(clock Clock) Option {
+	return func(options *options) error {
+		options.clock = clock
+		return nil
+	}
+}
+
+// WithExpirationQueue sets how the items are ordered by expiration time, see SetExpirationQueue
+func WithExpirationQueue(newQueue func() ExpirationQueue) Option {
+	return func(options *options) error {
+		options.newExpirationQueue = newQueue
+		return nil
+	}
+}
+
+// WithJanitor makes the cache expire its items with the goroutine of janitor instead of a goroutine of its own.
+// The cache gets the clock of the janitor unless WithClock is given, see WithJanitorClock.
+func WithJanitor(janitor *Janitor) Option {
+	return func(options *options) error {
+		options.janitor = janitor
+		return nil
+	}
+}
+
+// WithManualExpiration creates the cache without an expiration goroutine, as NewManualCache
+func WithManualExpiration() Option {
+	return func(options *options) error {
+		options.manual = true
+		return nil
+	}
+}
+
+// WithCallbackDispatcher sets the dispatcher running the expiration callbacks, see SetCallbackDispatcher
+func WithCallbackDispatcher(dispatcher *CallbackDispatcher) Option {
+	return func(options *options) error {
+		options.callbackDispatcher = dispatcher
+		return nil
+	}
+}
+
+// WithLoader sets the loader function of the cache, see SetLoaderFunction
+func WithLoader[K comparable, V any](loader LoaderFunction[K, V]) Option {
+	return typed("WithLoader", func(cache *Cache[K, V]) {
+		cache.SetLoaderFunction(loader)
+	})
+}
+
+// WithLoaderContext sets the loader function of the cache, see SetLoaderFunctionContext
+func WithLoaderContext[K comparable, V any](loader LoaderFunctionContext[K, V]) Option {
+	return typed("WithLoaderContext", func(cache *Cache[K, V]) {
+		cache.SetLoaderFunctionContext(loader)
+	})
+}
+
+// WithBatchLoader sets the batch loader function of the cache, see SetBatchLoaderFunction
+func WithBatchLoader[K comparable, V any](loader BatchLoaderFunction[K, V]) Option {
+	return typed("WithBatchLoader", func(cache *Cache[K, V]) {
+		cache.SetBatchLoaderFunction(loader)
+	})
+}
+
+// WithExpirationCallback sets the callback called when an item expires, see SetExpirationCallback
+func WithExpirationCallback[K comparable, V any](callback ExpireCallback[K, V]) Option {
+	return typed("WithExpirationCallback", func(cache *Cache[K, V]) {
+		cache.SetExpirationCallback(callback)
+	})
+}
+
+// WithExpirationReasonCallback sets the callback called with the reason an item expires, see SetExpirationReasonCallback
+func WithExpirationReasonCallback[K comparable, V any](callback ExpireReasonCallback[K, V]) Option {
+	return typed("WithExpirationReasonCallback", func(cache *Cache[K, V]) {
+		cache.SetExpirationReasonCallback(callback)
+	})
+}
+
+// WithCheckExpirationCallback sets the callback deciding whether an item expires, see SetCheckExpirationCallback
+func WithCheckExpirationCallback[K comparable, V any](callback CheckExpireCallback[K, V]) Option {
+	return typed("WithCheckExpirationCallback", func(cache *Cache[K, V]) {
+		cache.SetCheckExpirationCallback(callback)
+	})
+}
+
+// WithNewItemCallback sets the callback called when an item is added, see SetNewItemCallback
+func WithNewItemCallback[K comparable, V any](callback ExpireCallback[K, V]) Option {
+	return typed("WithNewItemCallback", func(cache *Cache[K, V]) {
+		cache.SetNewItemCallback(callback)
+	})
+}
+
+// WithWeigher sets the function calculating the cost of the items, see SetWeigher
+func WithWeigher[K comparable, V any](weigher Weigher[K, V]) Option {
+	return typed("WithWeigher", func(cache *Cache[K, V]) {
+		cache.SetWeigher(weigher)
+	})
+}
+
+// WithCodec sets how keys and values are encoded by Save and the write-ahead log, see SetCodec
+func WithCodec[K comparable, V any](keyCodec Codec[K], valueCodec Codec[V]) Option {
+	return typed("WithCodec", func(cache *Cache[K, V]) {
+		cache.SetCodec(keyCodec, valueCodec)
+	})
+}
+
+// WithEvictionPolicy sets the policy choosing the items evicted once the cache is full, see SetEvictionPolicy.
+// The key type can not be inferred from the policy, it is given explicitly: WithEvictionPolicy[string](NewLRUPolicy[string]()).
+func WithEvictionPolicy[K comparable](policy EvictionPolicy[K]) Option {
+	return typedKey[K]("WithEvictionPolicy", func(cache interface{ SetEvictionPolicy(EvictionPolicy[K]) }) {
+		cache.SetEvictionPolicy(policy)
+	})
+}
+
+// WithRefreshErrorCallback sets the callback called when a refresh fails, see SetRefreshErrorCallback
+func WithRefreshErrorCallback[K comparable](callback RefreshErrorCallback[K]) Option {
+	return typedKey[K]("WithRefreshErrorCallback", func(cache interface{ SetRefreshErrorCallback(RefreshErrorCallback[K]) }) {
+		cache.SetRefreshErrorCallback(callback)
+	})
+}
+
+// typed returns an option configuring a Cache[K, V], it fails for a cache of other types
+func typed[K comparable, V any](name string, configure func(cache *Cache[K, V])) Option {
+	return func(options *options) error {
+		options.typed = append(options.typed, func(cache any) error {
+			typedCache, ok := cache.(*Cache[K, V])
+			if !ok {
+				return OptionError{name, fmt.Sprintf("is for a Cache[%s, %s]", typeName[K](), typeName[V]())}
+			}
+			configure(typedCache)
+			return nil
+		})
+		return nil
+	}
+}
+
+// typedKey is like typed for the options that only depend on the key type, the cache meets the interface I
+func typedKey[K comparable, I any](name string, configure func(cache I)) Option {
+	return func(options *options) error {
+		options.typed = append(options.typed, func(cache any) error {
+			typedCache, ok := cache.(I)
+			if !ok {
+				return OptionError{name, fmt.Sprintf("is for a cache with %s keys", typeName[K]())}
+			}
+			configure(typedCache)
+			return nil
+		})
+		return nil
+	}
+}
+
+func typeName[T any]() string {
+	return reflect.TypeOf((*T)(nil)).Elem().String()
+}
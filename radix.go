@@ -0,0 +1,125 @@
+package ttl
+
+import (
+	"sort"
+	"strings"
+)
+
+// radixTree maps the string form of the keys to the keys, to find all the keys with a prefix
+type radixTree[K comparable] struct {
+	root radixNode[K]
+}
+
+// radixNode is a node of a radixTree, the path to a node is the concatenation of the prefixes on the way
+type radixNode[K comparable] struct {
+	prefix string
+	// children are sorted by the first byte of their prefix, which is different for each child
+	children []*radixNode[K]
+	leaf     bool
+	key      K
+}
+
+// child returns the child starting with b, or the index to insert it at
+func (node *radixNode[K]) child(b byte) (int, *radixNode[K]) {
+	i := sort.Search(len(node.children), func(i int) bool {
+		return node.children[i].prefix[0] >= b
+	})
+	if i < len(node.children) && node.children[i].prefix[0] == b {
+		return i, node.children[i]
+	}
+	return i, nil
+}
+
+// insert adds the key at path, replacing the key that was there
+func (tree *radixTree[K]) insert(path string, key K) {
+	node := &tree.root
+	for len(path) > 0 {
+		i, child := node.child(path[0])
+		if child == nil {
+			node.children = append(node.children, nil)
+			copy(node.children[i+1:], node.children[i:])
+			node.children[i] = &radixNode[K]{prefix: path, leaf: true, key: key}
+			return
+		}
+		common := 0
+		for common < len(path) && common < len(child.prefix) && path[common] == child.prefix[common] {
+			common++
+		}
+		if common < len(child.prefix) {
+			// the path leaves the prefix of the child halfway, split it
+			split := &radixNode[K]{prefix: child.prefix[:common], children: []*radixNode[K]{child}}
+			child.prefix = child.prefix[common:]
+			node.children[i] = split
+			child = split
+		}
+		path = path[common:]
+		node = child
+	}
+	node.leaf = true
+	node.key = key
+}
+
+// remove deletes the key at path, it returns false when there is none
+func (tree *radixTree[K]) remove(path string) bool {
+	return tree.root.remove(path)
+}
+
+func (node *radixNode[K]) remove(path string) bool {
+	if len(path) == 0 {
+		if !node.leaf {
+			return false
+		}
+		var zero K
+		node.leaf = false
+		node.key = zero
+		return true
+	}
+	i, child := node.child(path[0])
+	if child == nil || !strings.HasPrefix(path, child.prefix) || !child.remove(path[len(child.prefix):]) {
+		return false
+	}
+	// keep the tree compressed, nodes without a key have at least two children
+	if !child.leaf {
+		switch len(child.children) {
+		case 0:
+			node.children = append(node.children[:i], node.children[i+1:]...)
+		case 1:
+			grandchild := child.children[0]
+			grandchild.prefix = child.prefix + grandchild.prefix
+			node.children[i] = grandchild
+		}
+	}
+	return true
+}
+
+// withPrefix returns the keys whose path starts with prefix
+func (tree *radixTree[K]) withPrefix(prefix string) []K {
+	node := &tree.root
+	for len(prefix) > 0 {
+		_, child := node.child(prefix[0])
+		if child == nil {
+			return nil
+		}
+		if strings.HasPrefix(child.prefix, prefix) {
+			node = child
+			break
+		}
+		if !strings.HasPrefix(prefix, child.prefix) {
+			return nil
+		}
+		prefix = prefix[len(child.prefix):]
+		node = child
+	}
+	var keys []K
+	node.collect(&keys)
+	return keys
+}
+
+func (node *radixNode[K]) collect(keys *[]K) {
+	if node.leaf {
+		*keys = append(*keys, node.key)
+	}
+	for _, child := range node.children {
+		child.collect(keys)
+	}
+}
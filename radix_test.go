@@ -0,0 +1,32 @@
+package ttl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRadixTree(t *testing.T) {
+	tree := &radixTree[string]{}
+	paths := []string{"tenant:1", "tenant:10", "tenant:1:user", "tenant:2", "team", "t", ""}
+	for _, path := range paths {
+		tree.insert(path, path)
+	}
+	withPrefix := tree.withPrefix
+	assert.ElementsMatch(t, []string{"tenant:1", "tenant:1:user", "tenant:10"}, withPrefix("tenant:1"))
+	assert.ElementsMatch(t, []string{"team", "tenant:1", "tenant:1:user", "tenant:10", "tenant:2"}, withPrefix("te"))
+	assert.ElementsMatch(t, []string{"tenant:1:user"}, withPrefix("tenant:1:"))
+	assert.Len(t, withPrefix(""), len(paths))
+	assert.Empty(t, withPrefix("tenant:3"))
+	assert.Empty(t, withPrefix("tenant:1:users"))
+
+	assert.True(t, tree.remove("tenant:1"))
+	assert.False(t, tree.remove("tenant:1"))
+	assert.False(t, tree.remove("tenant"))
+	assert.ElementsMatch(t, []string{"tenant:1:user", "tenant:10"}, withPrefix("tenant:1"))
+	for _, path := range paths {
+		tree.remove(path)
+	}
+	assert.Empty(t, withPrefix(""))
+	assert.Empty(t, tree.root.children, "The tree is compressed again")
+}
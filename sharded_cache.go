@@ -0,0 +1,616 @@
+package ttl
+
+import (
+	"context"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// ShardedCache spreads the keys over several independently locked caches (shards), so that
+// operations on different keys do not contend for the same lock. Every shard has its own
+// ExpirationQueue, but a single goroutine takes care of the expiration of all of them.
+// Limits such as SetCacheSizeLimit and SetMaxCost are split between the shards, see shardLimit.
+type ShardedCache[K comparable, V any] struct {
+	mutex                  sync.Mutex
+	shards                 []*Cache[K, V]
+	sizeLimit              int
+	expirationNotification *expirationSignal
+	shutdownSignal         chan (chan struct{})
+	isShutDown             bool
+}
+
+// NewShardedCache creates a ShardedCache with the given amount of shards, GOMAXPROCS shards are used when it is lower than 1
+func NewShardedCache[K comparable, V any](shards int) *ShardedCache[K, V] {
+	if shards < 1 {
+		shards = runtime.GOMAXPROCS(0)
+	}
+	cache := &ShardedCache[K, V]{
+		shards:                 make([]*Cache[K, V], shards),
+		expirationNotification: newExpirationSignal(),
+		shutdownSignal:         make(chan chan struct{}),
+	}
+	for i := range cache.shards {
+		cache.shards[i] = newCache[K, V](cache.expirationNotification)
+	}
+	cache.expirationNotification.start(realClock{})
+	go cache.startExpirationProcessing()
+	return cache
+}
+
+func (cache *ShardedCache[K, V]) shard(key K) *Cache[K, V] {
+	return cache.shards[hashKey(key)%uint64(len(cache.shards))]
+}
+
+func (cache *ShardedCache[K, V]) startExpirationProcessing() {
+	for {
+		timer := cache.expirationNotification.current()
+		sleepTime := time.Hour
+		for _, shard := range cache.shards {
+			shard.mutex.Lock()
+			shardSleepTime := shard.nextExpiration()
+			shard.expirationTime = shard.clock.Now().Add(shardSleepTime)
+			shard.mutex.Unlock()
+			sleepTime = min(sleepTime, shardSleepTime)
+		}
+		cache.expirationNotification.reset(timer, sleepTime)
+		select {
+		case shutdownFeedback := <-cache.shutdownSignal:
+			cache.expirationNotification.stop()
+			for _, shard := range cache.shards {
+				shard.mutex.Lock()
+				if shard.expirationQueue.Len() > 0 {
+					shard.evictjob(Closed)
+				}
+				shard.mutex.Unlock()
+			}
+			shutdownFeedback <- struct{}{}
+			return
+		case <-timer.C():
+			for _, shard := range cache.shards {
+				shard.mutex.Lock()
+				if shard.expirationQueue.Len() > 0 {
+					shard.cleanjob()
+				}
+				shard.mutex.Unlock()
+			}
+		case <-cache.expirationNotification.notification:
+			continue
+		}
+	}
+}
+
+// Close calls Purge after stopping the goroutine that does ttl checking, for a clean shutdown.
+// The cache is no longer cleaning up after the first call to Close, repeated calls are safe and return ErrClosed.
+func (cache *ShardedCache[K, V]) Close() error {
+	cache.mutex.Lock()
+	if cache.isShutDown {
+		cache.mutex.Unlock()
+		return ErrClosed
+	}
+	cache.isShutDown = true
+	cache.mutex.Unlock()
+
+	for _, shard := range cache.shards {
+		shard.mutex.Lock()
+		shard.isShutDown = true
+		shard.mutex.Unlock()
+	}
+	feedback := make(chan struct{})
+	cache.shutdownSignal <- feedback
+	<-feedback
+	close(cache.shutdownSignal)
+	err := cache.Purge()
+	for _, shard := range cache.shards {
+		shard.closeSubscriptions()
+		shard.waitCallbacks()
+	}
+	return err
+}
+
+// Set is a thread-safe way to add new items to the map.
+func (cache *ShardedCache[K, V]) Set(key K, data V) error {
+	return cache.shard(key).Set(key, data)
+}
+
+// SetWithTTL is a thread-safe way to add new items to the map with individual ttl.
+func (cache *ShardedCache[K, V]) SetWithTTL(key K, data V, ttl time.Duration) error {
+	return cache.shard(key).SetWithTTL(key, data, ttl)
+}
+
+// SetWithCost is a thread-safe way to add new items to the map with individual ttl and cost.
+func (cache *ShardedCache[K, V]) SetWithCost(key K, data V, ttl time.Duration, cost int64) error {
+	return cache.shard(key).SetWithCost(key, data, ttl, cost)
+}
+
+// SetWithTags is like SetWithTTL but the item carries the given tags, see Cache.SetWithTags
+func (cache *ShardedCache[K, V]) SetWithTags(key K, data V, ttl time.Duration, tags ...string) error {
+	return cache.shard(key).SetWithTags(key, data, ttl, tags...)
+}
+
+// Get is a thread-safe way to lookup items
+// Every lookup, also touches the item, hence extending it's life
+func (cache *ShardedCache[K, V]) Get(key K) (V, error) {
+	return cache.shard(key).Get(key)
+}
+
+// GetWithTTL has exactly the same behaviour as Get but also returns
+// the remaining TTL for an specific item at the moment it its retrieved
+func (cache *ShardedCache[K, V]) GetWithTTL(key K) (V, time.Duration, error) {
+	return cache.shard(key).GetWithTTL(key)
+}
+
+// GetByLoader can take a per key loader function (ie. to propagate context)
+func (cache *ShardedCache[K, V]) GetByLoader(key K, customLoaderFunction LoaderFunction[K, V]) (V, time.Duration, error) {
+	return cache.shard(key).GetByLoader(key, customLoaderFunction)
+}
+
+// GetContext is like Get but the loader function, when set with SetLoaderFunctionContext, receives the context.
+func (cache *ShardedCache[K, V]) GetContext(ctx context.Context, key K) (V, error) {
+	return cache.shard(key).GetContext(ctx, key)
+}
+
+// GetByLoaderContext can take a per key loader function that receives the context.
+func (cache *ShardedCache[K, V]) GetByLoaderContext(ctx context.Context, key K, customLoaderFunction LoaderFunctionContext[K, V]) (V, time.Duration, error) {
+	return cache.shard(key).GetByLoaderContext(ctx, key, customLoaderFunction)
+}
+
+// Remove removes an item from the cache if it exists, triggers expiration callback when set. Can return ErrNotFound if the entry was not present.
+func (cache *ShardedCache[K, V]) Remove(key K) error {
+	return cache.shard(key).Remove(key)
+}
+
+// Touch resets the TTL of the key when it exists, returns ErrNotFound if the key is not present.
+func (cache *ShardedCache[K, V]) Touch(key K) error {
+	return cache.shard(key).Touch(key)
+}
+
+// GetOrSet returns the value of the key when it is in the cache and true, otherwise it adds the item, see Cache.GetOrSet
+func (cache *ShardedCache[K, V]) GetOrSet(key K, data V, ttl time.Duration) (V, bool, error) {
+	return cache.shard(key).GetOrSet(key, data, ttl)
+}
+
+// SetIfAbsent adds the item only when the key is not in the cache, see Cache.SetIfAbsent
+func (cache *ShardedCache[K, V]) SetIfAbsent(key K, data V, ttl time.Duration) (bool, error) {
+	return cache.shard(key).SetIfAbsent(key, data, ttl)
+}
+
+// Replace sets the item only when the key is in the cache, see Cache.Replace
+func (cache *ShardedCache[K, V]) Replace(key K, data V, ttl time.Duration) (bool, error) {
+	return cache.shard(key).Replace(key, data, ttl)
+}
+
+// CompareAndSwap replaces the value of the key with new when it is equal to old, see Cache.CompareAndSwap
+func (cache *ShardedCache[K, V]) CompareAndSwap(key K, old V, new V) (bool, error) {
+	return cache.shard(key).CompareAndSwap(key, old, new)
+}
+
+// Compute sets the key to the value returned by f while holding the lock of its shard, see Cache.Compute
+func (cache *ShardedCache[K, V]) Compute(key K, f func(old V, exists bool) (new V, ttl time.Duration, remove bool)) (V, error) {
+	return cache.shard(key).Compute(key, f)
+}
+
+// GetVersioned is like Get but it also returns the version of the item, see Cache.GetVersioned.
+// Versions are given per shard, they only compare between versions of the same key.
+func (cache *ShardedCache[K, V]) GetVersioned(key K) (V, uint64, error) {
+	return cache.shard(key).GetVersioned(key)
+}
+
+// SetIfVersion sets the item only when the key still has the given version, see Cache.SetIfVersion
+func (cache *ShardedCache[K, V]) SetIfVersion(key K, data V, ttl time.Duration, version uint64) error {
+	return cache.shard(key).SetIfVersion(key, data, ttl, version)
+}
+
+// RemoveByTag removes all the items carrying the tag from every shard, see Cache.RemoveByTag
+func (cache *ShardedCache[K, V]) RemoveByTag(tag string) (int, error) {
+	return cache.removeFromShards(func(shard *Cache[K, V]) (int, error) {
+		return shard.RemoveByTag(tag)
+	})
+}
+
+// RemoveByPrefix removes all the items whose key starts with prefix from every shard, see Cache.RemoveByPrefix
+func (cache *ShardedCache[K, V]) RemoveByPrefix(prefix string) (int, error) {
+	return cache.removeFromShards(func(shard *Cache[K, V]) (int, error) {
+		return shard.RemoveByPrefix(prefix)
+	})
+}
+
+// removeFromShards adds up the items removed from each shard by remove
+func (cache *ShardedCache[K, V]) removeFromShards(remove func(shard *Cache[K, V]) (int, error)) (int, error) {
+	removed := 0
+	var err error
+	for _, shard := range cache.shards {
+		shardRemoved, shardErr := remove(shard)
+		removed += shardRemoved
+		if shardErr != nil {
+			err = shardErr
+		}
+	}
+	return removed, err
+}
+
+// Count returns the number of items in the cache. Returns zero when the cache has been closed.
+func (cache *ShardedCache[K, V]) Count() int {
+	count := 0
+	for _, shard := range cache.shards {
+		count += shard.Count()
+	}
+	return count
+}
+
+// GetKeys returns all keys of items in the cache. Returns nil when the cache has been closed.
+func (cache *ShardedCache[K, V]) GetKeys() []K {
+	cache.mutex.Lock()
+	isShutDown := cache.isShutDown
+	cache.mutex.Unlock()
+	if isShutDown {
+		return nil
+	}
+	keys := make([]K, 0)
+	for _, shard := range cache.shards {
+		keys = append(keys, shard.GetKeys()...)
+	}
+	return keys
+}
+
+// Range calls f for every item in the cache until f returns false, see Cache.Range.
+// The view is consistent per shard, the shards are copied one after the other.
+func (cache *ShardedCache[K, V]) Range(f func(key K, value V, expiresAt time.Time) bool) {
+	for _, shard := range cache.shards {
+		for _, entry := range shard.liveEntries() {
+			if !f(entry.key, entry.data, entry.expiresAt) {
+				return
+			}
+		}
+	}
+}
+
+// GetMetrics exposes the metrics of the cache, added up over all the shards. This is a snapshot copy of the metrics.
+func (cache *ShardedCache[K, V]) GetMetrics() Metrics {
+	var metrics Metrics
+	for _, shard := range cache.shards {
+		metrics.add(shard.GetMetrics())
+	}
+	return metrics
+}
+
+// Purge will remove all entries
+func (cache *ShardedCache[K, V]) Purge() error {
+	for _, shard := range cache.shards {
+		if err := shard.Purge(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetTTL sets the global TTL value for items in the cache, which can be overridden at the item level.
+func (cache *ShardedCache[K, V]) SetTTL(ttl time.Duration) error {
+	for _, shard := range cache.shards {
+		if err := shard.SetTTL(ttl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetExpirationCallback sets a callback that will be called when an item expires
+func (cache *ShardedCache[K, V]) SetExpirationCallback(callback ExpireCallback[K, V]) {
+	for _, shard := range cache.shards {
+		shard.SetExpirationCallback(callback)
+	}
+}
+
+// SetExpirationReasonCallback sets a callback that will be called when an item expires, includes reason of expiry
+func (cache *ShardedCache[K, V]) SetExpirationReasonCallback(callback ExpireReasonCallback[K, V]) {
+	for _, shard := range cache.shards {
+		shard.SetExpirationReasonCallback(callback)
+	}
+}
+
+// SetCheckExpirationCallback sets a callback that will be called when an item is about to expire
+// in order to allow external code to decide whether the item expires or remains for another TTL cycle
+func (cache *ShardedCache[K, V]) SetCheckExpirationCallback(callback CheckExpireCallback[K, V]) {
+	for _, shard := range cache.shards {
+		shard.SetCheckExpirationCallback(callback)
+	}
+}
+
+// SetNewItemCallback sets a callback that will be called when a new item is added to the cache
+func (cache *ShardedCache[K, V]) SetNewItemCallback(callback ExpireCallback[K, V]) {
+	for _, shard := range cache.shards {
+		shard.SetNewItemCallback(callback)
+	}
+}
+
+// SkipTTLExtensionOnHit allows the user to change the cache behaviour, see Cache.SkipTTLExtensionOnHit
+func (cache *ShardedCache[K, V]) SkipTTLExtensionOnHit(value bool) {
+	for _, shard := range cache.shards {
+		shard.SkipTTLExtensionOnHit(value)
+	}
+}
+
+// SetLoaderFunction allows you to set a function to retrieve cache misses. The signature matches that of the Get function.
+// Additional Get calls on the same key block while fetching is in progress (groupcache style).
+func (cache *ShardedCache[K, V]) SetLoaderFunction(loader LoaderFunction[K, V]) {
+	for _, shard := range cache.shards {
+		shard.SetLoaderFunction(loader)
+	}
+}
+
+// SetLoaderFunctionContext is like SetLoaderFunction but the loader receives the context given to GetContext.
+func (cache *ShardedCache[K, V]) SetLoaderFunctionContext(loader LoaderFunctionContext[K, V]) {
+	for _, shard := range cache.shards {
+		shard.SetLoaderFunctionContext(loader)
+	}
+}
+
+// SetStaleWhileRevalidate keeps items in the cache for the given window once their TTL is over, see Cache.SetStaleWhileRevalidate
+func (cache *ShardedCache[K, V]) SetStaleWhileRevalidate(window time.Duration) {
+	for _, shard := range cache.shards {
+		shard.SetStaleWhileRevalidate(window)
+	}
+}
+
+// SetRefreshAhead makes the loader function refresh items once the given fraction of their TTL is over, see Cache.SetRefreshAhead
+func (cache *ShardedCache[K, V]) SetRefreshAhead(fraction float64) {
+	for _, shard := range cache.shards {
+		shard.SetRefreshAhead(fraction)
+	}
+}
+
+// SetWithRefreshAhead is like SetWithTTL but the item is refreshed ahead of its expiration with its own fraction of the TTL.
+func (cache *ShardedCache[K, V]) SetWithRefreshAhead(key K, data V, ttl time.Duration, fraction float64) error {
+	return cache.shard(key).SetWithRefreshAhead(key, data, ttl, fraction)
+}
+
+// SetRefreshErrorCallback sets a callback that will be called when the loader fails to refresh an item in the background
+func (cache *ShardedCache[K, V]) SetRefreshErrorCallback(callback RefreshErrorCallback[K]) {
+	for _, shard := range cache.shards {
+		shard.SetRefreshErrorCallback(callback)
+	}
+}
+
+// SetNegativeCaching caches the errors returned by the loader function for the given ttl, see Cache.SetNegativeCaching
+func (cache *ShardedCache[K, V]) SetNegativeCaching(ttl time.Duration, filter func(err error) bool) {
+	for _, shard := range cache.shards {
+		shard.SetNegativeCaching(ttl, filter)
+	}
+}
+
+// SetCacheSizeLimit sets a limit to the amount of cached items, every shard holds up to its share of the limit.
+// The shares add up to the limit unless it is lower than the amount of shards, see shardLimit.
+// Set to 0 to turn off
+func (cache *ShardedCache[K, V]) SetCacheSizeLimit(limit int) {
+	cache.mutex.Lock()
+	cache.sizeLimit = limit
+	cache.mutex.Unlock()
+	for i, shard := range cache.shards {
+		shard.SetCacheSizeLimit(int(shardLimit(int64(limit), len(cache.shards), i)))
+	}
+}
+
+// GetCacheSizeLimit returns the limit to the amount of cached items, as set with SetCacheSizeLimit
+func (cache *ShardedCache[K, V]) GetCacheSizeLimit() int {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return cache.sizeLimit
+}
+
+// SetMaxCost sets a limit to the total cost of the cached items, every shard holds up to its share of the cost.
+// The shares add up to the limit unless it is lower than the amount of shards, see shardLimit.
+// Set to 0 to turn off
+func (cache *ShardedCache[K, V]) SetMaxCost(maxCost int64) {
+	for i, shard := range cache.shards {
+		shard.SetMaxCost(shardLimit(maxCost, len(cache.shards), i))
+	}
+}
+
+// shardLimit returns the share of a limit held by the shard at index, the first limit%shards shards hold one more
+// so that the shares add up to the limit. A shard holds at least 1 as 0 turns the limit off, the shares of a limit
+// lower than the amount of shards add up to the amount of shards instead.
+func shardLimit(limit int64, shards int, index int) int64 {
+	if limit <= 0 {
+		return 0
+	}
+	share := limit / int64(shards)
+	if int64(index) < limit%int64(shards) {
+		share++
+	}
+	if share == 0 {
+		share = 1
+	}
+	return share
+}
+
+// SetWeigher sets a function to calculate the cost of the items added with Set or SetWithTTL.
+func (cache *ShardedCache[K, V]) SetWeigher(weigher Weigher[K, V]) {
+	for _, shard := range cache.shards {
+		shard.SetWeigher(weigher)
+	}
+}
+
+// SetEvictionPolicy sets the policy used by every shard to choose which item is evicted when its
+// size limit is reached. The function is called once per shard since policies can not be shared.
+// Set to nil to evict the closest item to being timed out.
+func (cache *ShardedCache[K, V]) SetEvictionPolicy(newPolicy func() EvictionPolicy[K]) {
+	for _, shard := range cache.shards {
+		if newPolicy == nil {
+			shard.SetEvictionPolicy(nil)
+		} else {
+			shard.SetEvictionPolicy(newPolicy())
+		}
+	}
+}
+
+// SetExpirationQueue sets how the items of every shard are ordered by expiration time, see Cache.SetExpirationQueue.
+// The function is called once per shard since queues can not be shared.
+func (cache *ShardedCache[K, V]) SetExpirationQueue(newQueue func() ExpirationQueue) {
+	for _, shard := range cache.shards {
+		shard.SetExpirationQueue(newQueue)
+	}
+}
+
+// SetCallbackDispatcher sets the dispatcher running the expiration callbacks of every shard, see Cache.SetCallbackDispatcher
+func (cache *ShardedCache[K, V]) SetCallbackDispatcher(dispatcher *CallbackDispatcher) {
+	for _, shard := range cache.shards {
+		shard.SetCallbackDispatcher(dispatcher)
+	}
+}
+
+// SetClock sets the clock of every shard, see Cache.SetClock
+func (cache *ShardedCache[K, V]) SetClock(clock Clock) {
+	for _, shard := range cache.shards {
+		shard.SetClock(clock)
+	}
+}
+
+// SetCodec sets how keys and values are encoded by Save and decoded by Load, a nil codec means GobCodec
+func (cache *ShardedCache[K, V]) SetCodec(keyCodec Codec[K], valueCodec Codec[V]) {
+	for _, shard := range cache.shards {
+		shard.SetCodec(keyCodec, valueCodec)
+	}
+}
+
+// Save writes the items of all the shards to w, the snapshot can be loaded by a Cache or a ShardedCache
+// with any amount of shards.
+func (cache *ShardedCache[K, V]) Save(w io.Writer) error {
+	var entries []snapshotEntry[K, V]
+	for _, shard := range cache.shards {
+		shard.mutex.Lock()
+		if shard.isShutDown {
+			shard.mutex.Unlock()
+			return ErrClosed
+		}
+		entries = append(entries, shard.snapshot()...)
+		shard.mutex.Unlock()
+	}
+	keyCodec, valueCodec := cache.codecs()
+	return writeSnapshot(w, entries, keyCodec, valueCodec)
+}
+
+// Load adds the items written by Save to the shards, see Cache.Load
+func (cache *ShardedCache[K, V]) Load(r io.Reader) error {
+	keyCodec, valueCodec := cache.codecs()
+	entries, err := readSnapshot(r, keyCodec, valueCodec)
+	if err != nil {
+		return err
+	}
+	shardEntries := make(map[*Cache[K, V]][]snapshotEntry[K, V])
+	for _, entry := range entries {
+		shard := cache.shard(entry.key)
+		shardEntries[shard] = append(shardEntries[shard], entry)
+	}
+	for shard, entries := range shardEntries {
+		if err := shard.restore(entries); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// codecs returns the codecs of the shards, they are all the same
+func (cache *ShardedCache[K, V]) codecs() (Codec[K], Codec[V]) {
+	shard := cache.shards[0]
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	return shard.codecs()
+}
+
+// Subscribe returns a channel receiving the events of all the shards, see Cache.Subscribe.
+// The events of a key are in order, there is no order between the events of keys in different shards.
+func (cache *ShardedCache[K, V]) Subscribe(buffer int) (<-chan Event[K, V], func()) {
+	subscription := &subscription[K, V]{events: make(chan Event[K, V], buffer)}
+	for _, shard := range cache.shards {
+		if !shard.subscribe(subscription) {
+			for _, shard := range cache.shards {
+				shard.unsubscribe(subscription)
+			}
+			subscription.close()
+			return subscription.events, func() {}
+		}
+	}
+	return subscription.events, func() {
+		for _, shard := range cache.shards {
+			shard.unsubscribe(subscription)
+		}
+		subscription.close()
+	}
+}
+
+// SetBatchLoaderFunction sets the function GetMulti uses to load the missing keys of each shard at once
+func (cache *ShardedCache[K, V]) SetBatchLoaderFunction(loader BatchLoaderFunction[K, V]) {
+	for _, shard := range cache.shards {
+		shard.SetBatchLoaderFunction(loader)
+	}
+}
+
+// GetMulti looks up the keys in their shards concurrently, see Cache.GetMulti. The batch loader function is
+// called once per shard with missing keys, the error is the one of one of the failed calls.
+func (cache *ShardedCache[K, V]) GetMulti(keys []K) (map[K]V, error) {
+	results := make(map[K]V, len(keys))
+	var err error
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	for shard, shardKeys := range cache.groupKeys(keys) {
+		wg.Add(1)
+		go func(shard *Cache[K, V], shardKeys []K) {
+			defer wg.Done()
+			shardResults, shardErr := shard.GetMulti(shardKeys)
+			lock.Lock()
+			defer lock.Unlock()
+			if shardErr != nil {
+				err = shardErr
+			}
+			for key, data := range shardResults {
+				results[key] = data
+			}
+		}(shard, shardKeys)
+	}
+	wg.Wait()
+	return results, err
+}
+
+// SetMultiWithTTL adds the items to their shards with the same ttl, see Cache.SetMultiWithTTL
+func (cache *ShardedCache[K, V]) SetMultiWithTTL(items map[K]V, ttl time.Duration) error {
+	shardItems := make(map[*Cache[K, V]]map[K]V)
+	for key, data := range items {
+		shard := cache.shard(key)
+		if shardItems[shard] == nil {
+			shardItems[shard] = make(map[K]V)
+		}
+		shardItems[shard][key] = data
+	}
+	var err error
+	for shard, items := range shardItems {
+		if shardErr := shard.SetMultiWithTTL(items, ttl); shardErr != nil {
+			err = shardErr
+		}
+	}
+	return err
+}
+
+// RemoveMulti removes the keys from their shards, see Cache.RemoveMulti
+func (cache *ShardedCache[K, V]) RemoveMulti(keys []K) (int, error) {
+	removed := 0
+	var err error
+	for shard, shardKeys := range cache.groupKeys(keys) {
+		shardRemoved, shardErr := shard.RemoveMulti(shardKeys)
+		removed += shardRemoved
+		if shardErr != nil {
+			err = shardErr
+		}
+	}
+	return removed, err
+}
+
+// groupKeys splits the keys by shard
+func (cache *ShardedCache[K, V]) groupKeys(keys []K) map[*Cache[K, V]][]K {
+	groups := make(map[*Cache[K, V]][]K)
+	for _, key := range keys {
+		shard := cache.shard(key)
+		groups[shard] = append(groups[shard], key)
+	}
+	return groups
+}
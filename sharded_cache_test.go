@@ -0,0 +1,358 @@
+package ttl_test
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/asgarciap/ttl/v4"
+	"github.com/asgarciap/ttl/v4/ttltest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardedCache_SimpleCache(t *testing.T) {
+	t.Parallel()
+	var cache SimpleCache[string, int] = NewShardedCache[string, int](4)
+
+	assert.Nil(t, cache.SetTTL(time.Second))
+	assert.Nil(t, cache.Set("k", 1))
+	data, err := cache.Get("k")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, data)
+	assert.Nil(t, cache.Remove("k"))
+	assert.Nil(t, cache.Purge())
+	assert.Nil(t, cache.Close())
+	assert.Equal(t, ErrClosed, cache.Close())
+}
+
+func TestShardedCache_EqualKeys(t *testing.T) {
+	t.Parallel()
+	// keys that are equal under == are in the same shard, whatever their representation
+	negativeZero := math.Copysign(0, -1)
+	floats := NewShardedCache[float64, int](64)
+	defer floats.Close()
+	floats.Set(0, 1)
+	data, err := floats.Get(negativeZero)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, data)
+
+	type name string
+	type key struct {
+		name   name
+		weight float64
+		ref    *int
+		tags   [2]name
+	}
+	ref := new(int)
+	structs := NewShardedCache[key, int](64)
+	defer structs.Close()
+	for i := 0; i < 100; i++ {
+		structs.Set(key{name: name(fmt.Sprint(i)), weight: 0, ref: ref, tags: [2]name{name(fmt.Sprint(i)), "a"}}, i)
+	}
+	for i := 0; i < 100; i++ {
+		data, err := structs.Get(key{name: name(fmt.Sprint(i)), weight: negativeZero, ref: ref, tags: [2]name{name(fmt.Sprint(i)), "a"}})
+		assert.Nil(t, err)
+		assert.Equal(t, i, data)
+	}
+	assert.Equal(t, 100, structs.Count())
+}
+
+func TestShardedCache_Aggregates(t *testing.T) {
+	t.Parallel()
+	cache := NewShardedCache[int, string](8)
+	defer cache.Close()
+
+	expected := make([]int, 100)
+	for i := 0; i < 100; i++ {
+		expected[i] = i
+		assert.Nil(t, cache.Set(i, fmt.Sprint(i)))
+	}
+	for i := 0; i < 100; i++ {
+		data, err := cache.Get(i)
+		assert.Nil(t, err)
+		assert.Equal(t, fmt.Sprint(i), data)
+	}
+	cache.Get(1000)
+
+	keys := cache.GetKeys()
+	sort.Ints(keys)
+	assert.Equal(t, expected, keys)
+	assert.Equal(t, 100, cache.Count())
+
+	metrics := cache.GetMetrics()
+	assert.Equal(t, int64(100), metrics.Inserted)
+	assert.Equal(t, int64(101), metrics.Hits)
+	assert.Equal(t, int64(100), metrics.Retrievals)
+	assert.Equal(t, int64(1), metrics.Misses)
+	assert.Equal(t, int64(100), metrics.Cost)
+
+	assert.Nil(t, cache.Purge())
+	assert.Equal(t, 0, cache.Count())
+}
+
+func TestShardedCache_Expiration(t *testing.T) {
+	t.Parallel()
+	cache := NewShardedCache[string, string](4)
+
+	var lock sync.Mutex
+	reasons := make(map[string]EvictionReason)
+	cache.SetExpirationReasonCallback(func(key string, reason EvictionReason, value string) {
+		lock.Lock()
+		defer lock.Unlock()
+		reasons[key] = reason
+	})
+	cache.SetTTL(time.Hour)
+	for i := 0; i < 10; i++ {
+		cache.SetWithTTL(fmt.Sprintf("short%d", i), "v", 50*time.Millisecond)
+	}
+	cache.Set("long", "v")
+	<-time.After(150 * time.Millisecond)
+	assert.Equal(t, 1, cache.Count(), "Expected all short lived items to be expired")
+	assert.Equal(t, int64(10), cache.GetMetrics().EvictedExpired)
+
+	cache.Close()
+	<-time.After(10 * time.Millisecond)
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, 11, len(reasons))
+	assert.Equal(t, Closed, reasons["long"])
+	assert.Equal(t, Expired, reasons["short0"])
+	assert.Nil(t, cache.GetKeys())
+	assert.Equal(t, 0, cache.Count())
+	_, err := cache.Get("long")
+	assert.Equal(t, ErrClosed, err)
+}
+
+func TestShardedCache_Limits(t *testing.T) {
+	t.Parallel()
+	cache := NewShardedCache[int, int](4)
+	defer cache.Close()
+
+	cache.SetCacheSizeLimit(40)
+	assert.Equal(t, 40, cache.GetCacheSizeLimit())
+	cache.SetEvictionPolicy(func() EvictionPolicy[int] {
+		return NewLRUPolicy[int]()
+	})
+	for i := 0; i < 1000; i++ {
+		cache.Set(i, i)
+	}
+	assert.LessOrEqual(t, cache.Count(), 40)
+	assert.Equal(t, int64(1000-cache.Count()), cache.GetMetrics().EvictedFull)
+
+	// the shares of the shards add up to the limit
+	cache.Purge()
+	cache.SetCacheSizeLimit(10)
+	assert.Equal(t, 10, cache.GetCacheSizeLimit())
+	for i := 0; i < 1000; i++ {
+		cache.Set(i, i)
+	}
+	assert.Equal(t, 10, cache.Count())
+
+	cache.Purge()
+	cache.SetCacheSizeLimit(0)
+	cache.SetEvictionPolicy(nil)
+	cache.SetMaxCost(100)
+	cache.SetWeigher(func(key int, value int) int64 {
+		return 10
+	})
+	for i := 0; i < 1000; i++ {
+		cache.Set(i, i)
+	}
+	assert.LessOrEqual(t, cache.GetMetrics().Cost, int64(100))
+
+	cache.Purge()
+	cache.SetMaxCost(62)
+	cache.SetWeigher(func(key int, value int) int64 {
+		return 1
+	})
+	for i := 0; i < 1000; i++ {
+		cache.Set(i, i)
+	}
+	assert.Equal(t, int64(62), cache.GetMetrics().Cost)
+}
+
+func TestShardedCache_Loader(t *testing.T) {
+	t.Parallel()
+	cache := NewShardedCache[string, string](4)
+	defer cache.Close()
+
+	cache.SetLoaderFunction(func(key string) (string, time.Duration, error) {
+		return "loaded " + key, 0, nil
+	})
+	data, err := cache.Get("a")
+	assert.Nil(t, err)
+	assert.Equal(t, "loaded a", data)
+
+	data, _, err = cache.GetByLoader("b", func(key string) (string, time.Duration, error) {
+		return "custom " + key, 0, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "custom b", data)
+	assert.Nil(t, cache.Touch("b"))
+	assert.Equal(t, 2, cache.Count())
+}
+
+func TestShardedCache_Subscribe(t *testing.T) {
+	t.Parallel()
+	cache := NewShardedCache[int, int](4)
+
+	events, cancel := cache.Subscribe(100)
+	defer cancel()
+	for i := 0; i < 10; i++ {
+		cache.Set(i, i)
+		cache.Remove(i)
+	}
+	cache.Close()
+
+	// the events of every key are in order
+	inserted := map[int]bool{}
+	for event := range events {
+		if event.Type == EventInserted {
+			inserted[event.Key] = true
+		} else {
+			assert.Equal(t, EventRemoved, event.Type)
+			assert.True(t, inserted[event.Key])
+		}
+	}
+	assert.Len(t, inserted, 10)
+}
+
+func TestShardedCache_Multi(t *testing.T) {
+	t.Parallel()
+	cache := NewShardedCache[int, int](4)
+	defer cache.Close()
+
+	var lock sync.Mutex
+	loaded := 0
+	cache.SetBatchLoaderFunction(func(keys []int) (map[int]Result[int], error) {
+		lock.Lock()
+		defer lock.Unlock()
+		results := map[int]Result[int]{}
+		for _, key := range keys {
+			loaded++
+			results[key] = Result[int]{Data: key * 10}
+		}
+		return results, nil
+	})
+	assert.Nil(t, cache.SetMultiWithTTL(map[int]int{1: 1, 2: 2}, time.Hour))
+
+	data, err := cache.GetMulti([]int{1, 2, 3, 4, 5})
+	assert.Nil(t, err)
+	assert.Equal(t, map[int]int{1: 1, 2: 2, 3: 30, 4: 40, 5: 50}, data)
+	assert.Equal(t, 3, loaded)
+
+	removed, err := cache.RemoveMulti([]int{1, 3, 6})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, removed)
+	assert.Equal(t, 3, cache.Count())
+}
+
+func TestShardedCache_AtomicOperations(t *testing.T) {
+	t.Parallel()
+	cache := NewShardedCache[int, int](4)
+	defer cache.Close()
+
+	for key := 0; key < 8; key++ {
+		added, err := cache.SetIfAbsent(key, key, time.Hour)
+		assert.Nil(t, err)
+		assert.True(t, added)
+	}
+	value, loaded, _ := cache.GetOrSet(3, 30, time.Hour)
+	assert.True(t, loaded)
+	assert.Equal(t, 3, value)
+	replaced, _ := cache.Replace(4, 40, time.Hour)
+	assert.True(t, replaced)
+	swapped, _ := cache.CompareAndSwap(5, 5, 50)
+	assert.True(t, swapped)
+	value, _ = cache.Compute(6, func(old int, exists bool) (int, time.Duration, bool) {
+		return old * 10, time.Hour, false
+	})
+	assert.Equal(t, 60, value)
+	cache.Compute(7, func(old int, exists bool) (int, time.Duration, bool) {
+		return 0, 0, true
+	})
+
+	data, _ := cache.GetMulti([]int{3, 4, 5, 6, 7})
+	assert.Equal(t, map[int]int{3: 3, 4: 40, 5: 50, 6: 60}, data)
+}
+
+func TestShardedCache_RemoveByTagAndPrefix(t *testing.T) {
+	t.Parallel()
+	cache := NewShardedCache[string, int](4)
+	defer cache.Close()
+
+	for i := 0; i < 20; i++ {
+		tag := "even"
+		if i%2 == 1 {
+			tag = "odd"
+		}
+		cache.SetWithTags(fmt.Sprintf("key:%d", i), i, time.Hour, tag)
+	}
+	removed, err := cache.RemoveByTag("odd")
+	assert.Nil(t, err)
+	assert.Equal(t, 10, removed)
+	removed, err = cache.RemoveByPrefix("key:1")
+	assert.Nil(t, err)
+	assert.Equal(t, 5, removed, "key:10 to key:18")
+	assert.Equal(t, 5, cache.Count())
+}
+
+func TestShardedCache_TimingWheel(t *testing.T) {
+	t.Parallel()
+	cache := NewShardedCache[int, int](4)
+	defer cache.Close()
+
+	cache.SetExpirationQueue(func() ExpirationQueue {
+		return NewTimingWheel(time.Millisecond)
+	})
+	for i := 0; i < 100; i++ {
+		cache.SetWithTTL(i, i, 10*time.Millisecond)
+	}
+	cache.SetWithTTL(100, 100, time.Hour)
+	assert.Eventually(t, func() bool {
+		return cache.Count() == 1
+	}, time.Second, time.Millisecond)
+}
+
+func TestShardedCache_FakeClock(t *testing.T) {
+	t.Parallel()
+	cache := NewShardedCache[int, int](4)
+	defer cache.Close()
+
+	clock := ttltest.NewFakeClock(time.Unix(0, 0))
+	cache.SetClock(clock)
+	for i := 0; i < 100; i++ {
+		cache.SetWithTTL(i, i, time.Duration(i+1)*time.Second)
+	}
+	clock.Advance(50 * time.Second)
+	assert.Equal(t, 50, cache.Count())
+	clock.Advance(time.Hour)
+	assert.Equal(t, 0, cache.Count())
+	assert.Equal(t, int64(100), cache.GetMetrics().EvictedExpired)
+}
+
+func TestShardedCache_CallbackDispatcher(t *testing.T) {
+	t.Parallel()
+	cache := NewShardedCache[int, int](4)
+
+	var lock sync.Mutex
+	closed := 0
+	cache.SetCallbackDispatcher(NewPoolDispatcher(2))
+	cache.SetExpirationReasonCallback(func(key int, reason EvictionReason, value int) {
+		lock.Lock()
+		defer lock.Unlock()
+		if reason == Closed {
+			closed++
+		}
+	})
+	for i := 0; i < 100; i++ {
+		cache.Set(i, i)
+	}
+	cache.Close()
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, 100, closed, "Close waits for the callbacks")
+}
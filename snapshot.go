@@ -0,0 +1,319 @@
+package ttl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"io"
+	"time"
+)
+
+const (
+	snapshotMagic = "TTLS"
+	// snapshotVersion is increased whenever the layout of the entries changes
+	snapshotVersion byte = 3
+)
+
+// Codec turns keys or values into bytes for Save and back into keys or values for Load
+type Codec[T any] interface {
+	Encode(value T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+// GobCodec is the default Codec, it uses encoding/gob. The concrete types stored in
+// interface values have to be registered with gob.Register.
+type GobCodec[T any] struct{}
+
+// Encode meets the Codec interface
+func (GobCodec[T]) Encode(value T) ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(&value); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// Decode meets the Codec interface
+func (GobCodec[T]) Decode(data []byte) (T, error) {
+	var value T
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&value)
+	return value, err
+}
+
+// snapshotEntry is an item as it is written by Save
+type snapshotEntry[K comparable, V any] struct {
+	key  K
+	data V
+	ttl  time.Duration
+	// expireAt is zero for items that do not expire
+	expireAt time.Time
+	cost     int64
+	version  uint64
+	tags     []string
+}
+
+// SetCodec sets how keys and values are encoded by Save and decoded by Load, a nil codec means GobCodec
+func (cache *Cache[K, V]) SetCodec(keyCodec Codec[K], valueCodec Codec[V]) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.keyCodec = keyCodec
+	cache.valueCodec = valueCodec
+}
+
+// codecs returns the codecs of the cache, falling back to GobCodec
+func (cache *Cache[K, V]) codecs() (Codec[K], Codec[V]) {
+	var keyCodec Codec[K] = GobCodec[K]{}
+	var valueCodec Codec[V] = GobCodec[V]{}
+	if cache.keyCodec != nil {
+		keyCodec = cache.keyCodec
+	}
+	if cache.valueCodec != nil {
+		valueCodec = cache.valueCodec
+	}
+	return keyCodec, valueCodec
+}
+
+// Save writes the items of the cache to w, so that a cache can be filled with them by Load, for example
+// after a restart. Every item keeps its TTL and the time at which it expires. Cached loader errors are not saved.
+func (cache *Cache[K, V]) Save(w io.Writer) error {
+	cache.mutex.Lock()
+	if cache.isShutDown {
+		cache.mutex.Unlock()
+		return ErrClosed
+	}
+	entries := cache.snapshot()
+	keyCodec, valueCodec := cache.codecs()
+	cache.mutex.Unlock()
+	return writeSnapshot(w, entries, keyCodec, valueCodec)
+}
+
+// Load adds the items written by Save to the cache, replacing the items with the same keys. Items that expired
+// in the meantime are dropped, the others expire at the same time as they would have in the saved cache.
+// The size limit and max cost apply as usual and the new item callback is not called.
+// Nothing is added when r can not be decoded, ErrInvalidSnapshot is returned when r was not written by Save.
+func (cache *Cache[K, V]) Load(r io.Reader) error {
+	cache.mutex.Lock()
+	keyCodec, valueCodec := cache.codecs()
+	cache.mutex.Unlock()
+	entries, err := readSnapshot(r, keyCodec, valueCodec)
+	if err != nil {
+		return err
+	}
+	return cache.restore(entries)
+}
+
+// snapshot returns the items that can be saved
+func (cache *Cache[K, V]) snapshot() []snapshotEntry[K, V] {
+	now := cache.clock.Now()
+	entries := make([]snapshotEntry[K, V], 0, len(cache.items))
+	for _, item := range cache.items {
+		if item.err != nil || item.expired(now) {
+			continue
+		}
+		entry := snapshotEntry[K, V]{key: item.key, data: item.data, ttl: item.ttl, cost: item.cost, version: item.version, tags: item.tags}
+		if item.ttl > 0 {
+			entry.expireAt = item.expireAt
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// restore adds saved items to the cache, dropping the ones that expired
+func (cache *Cache[K, V]) restore(entries []snapshotEntry[K, V]) error {
+	cache.mutex.Lock()
+	if cache.isShutDown {
+		cache.mutex.Unlock()
+		return ErrClosed
+	}
+	err := cache.restoreLocked(entries)
+	cache.mutex.Unlock()
+	cache.notifyExpiration()
+	return err
+}
+
+// restoreLocked does the work of restore while holding the lock, the items are recorded in the write-ahead log
+func (cache *Cache[K, V]) restoreLocked(entries []snapshotEntry[K, V]) error {
+	var walErr error
+	now := cache.clock.Now()
+	for _, entry := range entries {
+		if entry.ttl > 0 && !entry.expireAt.Add(cache.staleTTL).After(now) {
+			continue
+		}
+		_, citem, err := cache.setLocked(entry.key, entry.data, entry.ttl, entry.cost, nil)
+		if err != nil {
+			// the item alone exceeds the max cost of this cache
+			continue
+		}
+		if entry.ttl > 0 {
+			citem.setExpireAt(entry.expireAt)
+			cache.expirationQueue.Update(citem)
+		}
+		cache.setTags(citem, entry.tags)
+		// the item keeps its version, later changes get higher ones
+		citem.version = entry.version
+		if entry.version > cache.version {
+			cache.version = entry.version
+		}
+		if err := cache.logSet(citem); err != nil && walErr == nil {
+			walErr = err
+		}
+	}
+	return walErr
+}
+
+func writeSnapshot[K comparable, V any](w io.Writer, entries []snapshotEntry[K, V], keyCodec Codec[K], valueCodec Codec[V]) error {
+	writer := bufio.NewWriter(w)
+	writer.WriteString(snapshotMagic)
+	writer.WriteByte(snapshotVersion)
+	writeUvarint(writer, uint64(len(entries)))
+	for _, entry := range entries {
+		if err := writeSnapshotEntry(writer, entry, keyCodec, valueCodec); err != nil {
+			return err
+		}
+	}
+	// errors of the writer are sticky, they are returned by Flush
+	return writer.Flush()
+}
+
+func readSnapshot[K comparable, V any](r io.Reader, keyCodec Codec[K], valueCodec Codec[V]) ([]snapshotEntry[K, V], error) {
+	reader := bufio.NewReader(r)
+	header := make([]byte, len(snapshotMagic)+1)
+	if _, err := io.ReadFull(reader, header); err != nil || string(header[:len(snapshotMagic)]) != snapshotMagic ||
+		header[len(snapshotMagic)] != snapshotVersion {
+		return nil, ErrInvalidSnapshot
+	}
+	count, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	// the count is not trusted to allocate memory up front
+	capacity := count
+	if capacity > 1024 {
+		capacity = 1024
+	}
+	entries := make([]snapshotEntry[K, V], 0, capacity)
+	for i := uint64(0); i < count; i++ {
+		entry, err := readSnapshotEntry(reader, keyCodec, valueCodec)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func writeSnapshotEntry[K comparable, V any](writer *bufio.Writer, entry snapshotEntry[K, V], keyCodec Codec[K], valueCodec Codec[V]) error {
+	key, err := keyCodec.Encode(entry.key)
+	if err != nil {
+		return err
+	}
+	data, err := valueCodec.Encode(entry.data)
+	if err != nil {
+		return err
+	}
+	writeBytes(writer, key)
+	writeBytes(writer, data)
+	writeVarint(writer, int64(entry.ttl))
+	writeVarint(writer, unixNano(entry.expireAt))
+	writeVarint(writer, entry.cost)
+	writeUvarint(writer, entry.version)
+	writeUvarint(writer, uint64(len(entry.tags)))
+	for _, tag := range entry.tags {
+		writeBytes(writer, []byte(tag))
+	}
+	return nil
+}
+
+func readSnapshotEntry[K comparable, V any](reader *bufio.Reader, keyCodec Codec[K], valueCodec Codec[V]) (snapshotEntry[K, V], error) {
+	var entry snapshotEntry[K, V]
+	key, err := readBytes(reader)
+	if err != nil {
+		return entry, err
+	}
+	data, err := readBytes(reader)
+	if err != nil {
+		return entry, err
+	}
+	var fields [3]int64
+	for i := range fields {
+		if fields[i], err = binary.ReadVarint(reader); err != nil {
+			return entry, unexpectedEOF(err)
+		}
+	}
+	version, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return entry, unexpectedEOF(err)
+	}
+	tags, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return entry, unexpectedEOF(err)
+	}
+	for ; tags > 0; tags-- {
+		tag, err := readBytes(reader)
+		if err != nil {
+			return entry, err
+		}
+		entry.tags = append(entry.tags, string(tag))
+	}
+	if entry.key, err = keyCodec.Decode(key); err != nil {
+		return entry, err
+	}
+	if entry.data, err = valueCodec.Decode(data); err != nil {
+		return entry, err
+	}
+	entry.ttl = time.Duration(fields[0])
+	if fields[1] != 0 {
+		entry.expireAt = time.Unix(0, fields[1])
+	}
+	entry.cost = fields[2]
+	entry.version = version
+	return entry, nil
+}
+
+func writeUvarint(writer *bufio.Writer, value uint64) {
+	var buffer [binary.MaxVarintLen64]byte
+	writer.Write(buffer[:binary.PutUvarint(buffer[:], value)])
+}
+
+func writeVarint(writer *bufio.Writer, value int64) {
+	var buffer [binary.MaxVarintLen64]byte
+	writer.Write(buffer[:binary.PutVarint(buffer[:], value)])
+}
+
+// writeBytes writes the length of data followed by data
+func writeBytes(writer *bufio.Writer, data []byte) {
+	writeUvarint(writer, uint64(len(data)))
+	writer.Write(data)
+}
+
+// readBytes reads data written by writeBytes. The buffer grows while reading, so that a corrupted
+// length does not allocate more memory than the size of the input.
+func readBytes(reader *bufio.Reader) ([]byte, error) {
+	length, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	var buffer bytes.Buffer
+	if _, err := io.CopyN(&buffer, reader, int64(length)); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// unixNano is like time.UnixNano but zero for the zero time
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// unexpectedEOF reports input that ends in the middle of an entry
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,113 @@
+package ttl
+
+import (
+	"reflect"
+	"time"
+)
+
+// SetWithTags is like SetWithTTL but the item carries the given tags, replacing the tags it had, see RemoveByTag.
+// Updates of the item with the other set methods, or by the loader, keep its tags.
+func (cache *Cache[K, V]) SetWithTags(key K, data V, ttl time.Duration, tags ...string) error {
+	defer cache.setLatency.observe(time.Now())
+	cache.mutex.Lock()
+	if cache.isShutDown {
+		cache.mutex.Unlock()
+		return ErrClosed
+	}
+	isNew, citem, err := cache.setLocked(key, data, ttl, costFromWeigher, nil)
+	if err != nil {
+		cache.mutex.Unlock()
+		return err
+	}
+	cache.setTags(citem, tags)
+	err = cache.logSet(citem)
+	cache.mutex.Unlock()
+	cache.stored(isNew, key, data)
+	return err
+}
+
+// RemoveByTag removes all the items carrying the tag, as Remove does for each of them.
+// Returns the amount of items removed.
+func (cache *Cache[K, V]) RemoveByTag(tag string) (int, error) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if cache.isShutDown {
+		return 0, ErrClosed
+	}
+	keys := make([]K, 0, len(cache.tags[tag]))
+	for key := range cache.tags[tag] {
+		keys = append(keys, key)
+	}
+	return cache.removeKeys(keys)
+}
+
+// RemoveByPrefix removes all the items whose key starts with prefix, as Remove does for each of them.
+// The keys must be strings, or of a type based on string, otherwise ErrPrefixUnsupported is returned.
+// Returns the amount of items removed.
+func (cache *Cache[K, V]) RemoveByPrefix(prefix string) (int, error) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if cache.isShutDown {
+		return 0, ErrClosed
+	}
+	if reflect.TypeOf((*K)(nil)).Elem().Kind() != reflect.String {
+		return 0, ErrPrefixUnsupported
+	}
+	if cache.keyIndex == nil {
+		// the index costs memory and time on every set, it is only kept once prefixes are removed
+		cache.keyIndex = &radixTree[K]{}
+		for key := range cache.items {
+			cache.keyIndex.insert(keyString(key), key)
+		}
+	}
+	return cache.removeKeys(cache.keyIndex.withPrefix(prefix))
+}
+
+// keyString returns the string of a key of a cache with a key index
+func keyString[K comparable](key K) string {
+	if s, ok := any(key).(string); ok {
+		return s
+	}
+	return reflect.ValueOf(key).String()
+}
+
+// indexItem adds a new item to the key index, once it is built
+func (cache *Cache[K, V]) indexItem(item *item[K, V]) {
+	if cache.keyIndex != nil {
+		cache.keyIndex.insert(keyString(item.key), item.key)
+	}
+}
+
+// unindexItem removes an item that leaves the cache from the key and tag indexes
+func (cache *Cache[K, V]) unindexItem(item *item[K, V]) {
+	if cache.keyIndex != nil {
+		cache.keyIndex.remove(keyString(item.key))
+	}
+	cache.untag(item)
+}
+
+// setTags replaces the tags of an item in the cache
+func (cache *Cache[K, V]) setTags(item *item[K, V], tags []string) {
+	cache.untag(item)
+	item.tags = nil
+	for _, tag := range tags {
+		keys, exists := cache.tags[tag]
+		if !exists {
+			keys = make(map[K]struct{})
+			cache.tags[tag] = keys
+		}
+		if _, tagged := keys[item.key]; !tagged {
+			keys[item.key] = struct{}{}
+			item.tags = append(item.tags, tag)
+		}
+	}
+}
+
+func (cache *Cache[K, V]) untag(item *item[K, V]) {
+	for _, tag := range item.tags {
+		delete(cache.tags[tag], item.key)
+		if len(cache.tags[tag]) == 0 {
+			delete(cache.tags, tag)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package ttl
+
+import (
+	"math/bits"
+	"time"
+)
+
+// ExpirationQueue orders the items of a cache by the time they are due, see SetExpirationQueue.
+// ExpirationHeap is exact, TimingWheel trades precision for constant time operations.
+type ExpirationQueue interface {
+	Len() int
+	Add(entry ExpirationHeapEntry)
+	Update(entry ExpirationHeapEntry)
+	Remove(entry ExpirationHeapEntry)
+	// Peek returns the entry that is due first, within the precision of the queue, the entries that do not expire come last
+	Peek() ExpirationHeapEntry
+	// NextExpiration returns when the queue has entries due, zero when none of its entries expire
+	NextExpiration() time.Time
+	// Advance gives the current time to the queue, before NextExpiration and Peek are used to find the entries due
+	Advance(now time.Time)
+}
+
+const (
+	wheelBits   = 6
+	wheelSlots  = 1 << wheelBits
+	wheelLevels = 6
+	// besides the slots of the levels, the wheel keeps lists for the entries that are
+	// already due, that are due beyond the last level and that never expire
+	wheelOverdue  = wheelLevels * wheelSlots
+	wheelOverflow = wheelOverdue + 1
+	wheelForever  = wheelOverdue + 2
+	wheelLists    = wheelOverdue + 3
+)
+
+// TimingWheel is a hierarchical timing wheel: an ExpirationQueue with constant time operations, for caches
+// with millions of items. Entries are kept in slots of one tick, in levels of 64 slots where each slot spans the
+// whole previous level, and they are due at the end of their slot, so items expire up to one tick late.
+type TimingWheel struct {
+	tick int64
+	// current is the tick the wheel advanced to, the slots before it were moved to the overdue list
+	current int64
+	started bool
+	entries []wheelEntry
+	// heads holds the first entry of each list, the entries are linked through their neighbours
+	heads [wheelLists]int
+	// occupied has a bit set for every slot of a level with entries
+	occupied [wheelLevels]uint64
+}
+
+type wheelEntry struct {
+	entry ExpirationHeapEntry
+	list  int
+	prev  int
+	next  int
+}
+
+// NewTimingWheel creates a TimingWheel with the given tick, its precision. A millisecond is used when it is not positive.
+func NewTimingWheel(tick time.Duration) *TimingWheel {
+	if tick <= 0 {
+		tick = time.Millisecond
+	}
+	wheel := &TimingWheel{tick: int64(tick)}
+	for i := range wheel.heads {
+		wheel.heads[i] = EntryNotIndexed
+	}
+	return wheel
+}
+
+// Len returns the number of entries in the wheel
+func (wheel *TimingWheel) Len() int {
+	return len(wheel.entries)
+}
+
+// Add inserts an entry in the wheel
+func (wheel *TimingWheel) Add(entry ExpirationHeapEntry) {
+	index := len(wheel.entries)
+	wheel.entries = append(wheel.entries, wheelEntry{entry: entry})
+	entry.SetIndex(index)
+	wheel.link(index, wheel.listOf(entry))
+}
+
+// Update moves an entry after its expiration time changed
+func (wheel *TimingWheel) Update(entry ExpirationHeapEntry) {
+	index := entry.GetIndex()
+	if index == EntryNotIndexed {
+		return
+	}
+	if list := wheel.listOf(entry); list != wheel.entries[index].list {
+		wheel.unlink(index)
+		wheel.link(index, list)
+	}
+}
+
+// Remove removes an entry from the wheel
+func (wheel *TimingWheel) Remove(entry ExpirationHeapEntry) {
+	index := entry.GetIndex()
+	if index == EntryNotIndexed {
+		return
+	}
+	wheel.unlink(index)
+	last := len(wheel.entries) - 1
+	if index != last {
+		// the last entry fills the hole
+		moved := wheel.entries[last]
+		wheel.unlink(last)
+		wheel.entries[index] = wheelEntry{entry: moved.entry}
+		moved.entry.SetIndex(index)
+		wheel.link(index, moved.list)
+	}
+	wheel.entries[last] = wheelEntry{}
+	wheel.entries = wheel.entries[:last]
+	entry.SetIndex(EntryNotIndexed)
+}
+
+// Peek returns an entry of the first slot with entries, the entries that are due come first
+func (wheel *TimingWheel) Peek() ExpirationHeapEntry {
+	if head := wheel.heads[wheelOverdue]; head != EntryNotIndexed {
+		return wheel.entries[head].entry
+	}
+	for level, occupied := range wheel.occupied {
+		if occupied != 0 {
+			return wheel.entries[wheel.heads[level*wheelSlots+bits.TrailingZeros64(occupied)]].entry
+		}
+	}
+	for _, list := range []int{wheelOverflow, wheelForever} {
+		if head := wheel.heads[list]; head != EntryNotIndexed {
+			return wheel.entries[head].entry
+		}
+	}
+	return nil
+}
+
+// NextExpiration returns the end of the first slot with entries, or when the entries of a slot
+// of a higher level have to be spread over the lower levels
+func (wheel *TimingWheel) NextExpiration() time.Time {
+	if wheel.heads[wheelOverdue] != EntryNotIndexed {
+		return time.Unix(0, wheel.current*wheel.tick)
+	}
+	if list, at := wheel.nextSlot(); list != EntryNotIndexed {
+		if list < wheelSlots {
+			at++
+		}
+		return time.Unix(0, at*wheel.tick)
+	}
+	return time.Time{}
+}
+
+// Advance moves the wheel to the tick of now: the entries of the slots that are over become
+// overdue and the slots of the higher levels that are reached are spread over the lower levels
+func (wheel *TimingWheel) Advance(now time.Time) {
+	target := now.UnixNano() / wheel.tick
+	if !wheel.started {
+		// the entries added before wait in the overflow list
+		wheel.started = true
+		wheel.current = target
+		wheel.relink(wheelOverflow)
+		return
+	}
+	for {
+		list, at := wheel.nextSlot()
+		if list == EntryNotIndexed || at > target || (at == target && list < wheelSlots) {
+			break
+		}
+		wheel.current = at
+		if list < wheelSlots {
+			for index := wheel.take(list); index != EntryNotIndexed; {
+				next := wheel.entries[index].next
+				wheel.link(index, wheelOverdue)
+				index = next
+			}
+		} else {
+			wheel.relink(list)
+		}
+	}
+	if target > wheel.current {
+		wheel.current = target
+	}
+}
+
+// nextSlot returns the list that has to be processed first and the tick at which it starts,
+// the slots of the higher levels go first on a tie as they can add entries to the lower ones
+func (wheel *TimingWheel) nextSlot() (int, int64) {
+	list, at := EntryNotIndexed, int64(0)
+	for level, occupied := range wheel.occupied {
+		if occupied == 0 {
+			continue
+		}
+		slot := bits.TrailingZeros64(occupied)
+		shift := uint(wheelBits * level)
+		block := wheel.current >> (shift + wheelBits) << (shift + wheelBits)
+		if slotAt := block | int64(slot)<<shift; list == EntryNotIndexed || slotAt <= at {
+			list, at = level*wheelSlots+slot, slotAt
+		}
+	}
+	if wheel.heads[wheelOverflow] != EntryNotIndexed {
+		const span = wheelBits * wheelLevels
+		if overflowAt := (wheel.current>>span + 1) << span; list == EntryNotIndexed || overflowAt <= at {
+			list, at = wheelOverflow, overflowAt
+		}
+	}
+	return list, at
+}
+
+// listOf returns the list an entry belongs to: the slot of the lowest level that
+// shares the slot of the level above it with the current tick
+func (wheel *TimingWheel) listOf(entry ExpirationHeapEntry) int {
+	expiresAt := entry.ExpiresAt()
+	if expiresAt.IsZero() {
+		return wheelForever
+	}
+	if !wheel.started {
+		return wheelOverflow
+	}
+	due := expiresAt.UnixNano() / wheel.tick
+	if due < wheel.current {
+		return wheelOverdue
+	}
+	for level := 0; level < wheelLevels; level++ {
+		shift := uint(wheelBits * level)
+		if due>>(shift+wheelBits) == wheel.current>>(shift+wheelBits) {
+			return level*wheelSlots + int(due>>shift)&(wheelSlots-1)
+		}
+	}
+	return wheelOverflow
+}
+
+// relink empties a list and adds its entries again, to the lists they belong to now
+func (wheel *TimingWheel) relink(list int) {
+	for index := wheel.take(list); index != EntryNotIndexed; {
+		next := wheel.entries[index].next
+		wheel.link(index, wheel.listOf(wheel.entries[index].entry))
+		index = next
+	}
+}
+
+// take empties a list, it returns its first entry to go over the entries that were in it
+func (wheel *TimingWheel) take(list int) int {
+	head := wheel.heads[list]
+	wheel.heads[list] = EntryNotIndexed
+	if list < wheelOverdue {
+		wheel.occupied[list/wheelSlots] &^= 1 << (list % wheelSlots)
+	}
+	return head
+}
+
+func (wheel *TimingWheel) link(index int, list int) {
+	entry := &wheel.entries[index]
+	entry.list = list
+	entry.prev = EntryNotIndexed
+	entry.next = wheel.heads[list]
+	if entry.next != EntryNotIndexed {
+		wheel.entries[entry.next].prev = index
+	}
+	wheel.heads[list] = index
+	if list < wheelOverdue {
+		wheel.occupied[list/wheelSlots] |= 1 << (list % wheelSlots)
+	}
+}
+
+func (wheel *TimingWheel) unlink(index int) {
+	entry := &wheel.entries[index]
+	if entry.prev != EntryNotIndexed {
+		wheel.entries[entry.prev].next = entry.next
+	} else {
+		wheel.heads[entry.list] = entry.next
+	}
+	if entry.next != EntryNotIndexed {
+		wheel.entries[entry.next].prev = entry.prev
+	}
+	if wheel.heads[entry.list] == EntryNotIndexed && entry.list < wheelOverdue {
+		wheel.occupied[entry.list/wheelSlots] &^= 1 << (entry.list % wheelSlots)
+	}
+}
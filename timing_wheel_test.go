@@ -0,0 +1,126 @@
+package ttl
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimingWheel_Order(t *testing.T) {
+	start := time.Unix(1000, 0)
+	wheel := NewTimingWheel(time.Millisecond)
+	// entries added before the first Advance are placed once the wheel knows the time
+	forever := &testExpirationItem{index: EntryNotIndexed}
+	wheel.Add(forever)
+	late := &testExpirationItem{validUntil: start.Add(-time.Second), index: EntryNotIndexed}
+	wheel.Add(late)
+	wheel.Advance(start)
+	assert.Equal(t, late, wheel.Peek())
+	assert.Equal(t, start, wheel.NextExpiration())
+	wheel.Remove(late)
+
+	items := map[time.Duration]*testExpirationItem{}
+	for _, after := range []time.Duration{time.Hour, 5 * time.Millisecond, 100 * time.Millisecond, 10 * time.Second} {
+		items[after] = &testExpirationItem{validUntil: start.Add(after), index: EntryNotIndexed}
+		wheel.Add(items[after])
+	}
+	assert.Equal(t, 5, wheel.Len())
+	assert.Equal(t, items[5*time.Millisecond], wheel.Peek())
+	assert.Equal(t, start.Add(6*time.Millisecond), wheel.NextExpiration(), "Entries are due at the end of their tick")
+
+	wheel.Advance(start.Add(6 * time.Millisecond))
+	assert.Equal(t, items[5*time.Millisecond], wheel.Peek())
+	wheel.Remove(items[5*time.Millisecond])
+	assert.Equal(t, EntryNotIndexed, items[5*time.Millisecond].GetIndex())
+
+	// the higher levels are spread over the lower ones as time goes by
+	for _, after := range []time.Duration{100 * time.Millisecond, 10 * time.Second, time.Hour} {
+		assert.Equal(t, items[after], wheel.Peek())
+		assert.False(t, wheel.NextExpiration().After(start.Add(after+time.Millisecond)))
+		for now := wheel.NextExpiration(); !now.After(start.Add(after)); now = wheel.NextExpiration() {
+			wheel.Advance(now)
+		}
+		wheel.Advance(start.Add(after + time.Millisecond))
+		assert.Equal(t, items[after], wheel.Peek())
+		assert.Equal(t, start.Add(after+time.Millisecond), wheel.NextExpiration(), "The entry is overdue")
+		wheel.Remove(items[after])
+	}
+	assert.Equal(t, forever, wheel.Peek())
+	assert.True(t, wheel.NextExpiration().IsZero())
+
+	// an update moves the entry
+	forever.validUntil = start.Add(2 * time.Hour)
+	wheel.Update(forever)
+	assert.Equal(t, forever, wheel.Peek())
+	assert.False(t, wheel.NextExpiration().After(start.Add(2*time.Hour+time.Millisecond)))
+	wheel.Remove(forever)
+	assert.Nil(t, wheel.Peek())
+	assert.Equal(t, 0, wheel.Len())
+}
+
+func TestTimingWheel_Random(t *testing.T) {
+	// with a microsecond tick the entries due in days wait in the overflow list
+	for _, tick := range []time.Duration{time.Millisecond, time.Microsecond} {
+		testTimingWheelRandom(t, tick)
+	}
+}
+
+func testTimingWheelRandom(t *testing.T, tick time.Duration) {
+	start := time.Unix(0, 1700000000123456789)
+	wheel := NewTimingWheel(tick)
+	wheel.Advance(start)
+	random := rand.New(rand.NewSource(1))
+	randomTime := func(now time.Time) time.Time {
+		// up to about 3 days ahead, past the first levels
+		return now.Add(time.Duration(random.Int63n(int64(time.Duration(1) << random.Intn(48)))))
+	}
+
+	now := start
+	live := map[*testExpirationItem]bool{}
+	for round := 0; round < 1000; round++ {
+		for i := 0; i < 20; i++ {
+			item := &testExpirationItem{validUntil: randomTime(now), index: EntryNotIndexed}
+			wheel.Add(item)
+			live[item] = true
+		}
+		for item := range live {
+			switch random.Intn(10) {
+			case 0:
+				item.validUntil = randomTime(now)
+				wheel.Update(item)
+			case 1:
+				wheel.Remove(item)
+				delete(live, item)
+			}
+			if random.Intn(4) == 0 {
+				break
+			}
+		}
+
+		now = now.Add(time.Duration(random.Int63n(int64(2 * time.Minute))))
+		wheel.Advance(now)
+		for entry := wheel.Peek(); entry != nil && entry.ExpiresAt().Before(now); entry = wheel.Peek() {
+			wheel.Remove(entry)
+			delete(live, entry.(*testExpirationItem))
+		}
+		// entries expire at most one tick late
+		for item := range live {
+			assert.False(t, item.validUntil.Before(now.Truncate(tick).Add(-tick)), "entry due at %v is late at %v", item.validUntil, now)
+		}
+		if next := wheel.NextExpiration(); len(live) > 0 {
+			var first time.Time
+			for item := range live {
+				if first.IsZero() || item.validUntil.Before(first) {
+					first = item.validUntil
+				}
+			}
+			assert.False(t, next.After(first.Add(tick)), "next expiration %v is after the first entry %v", next, first)
+		}
+		if t.Failed() {
+			return
+		}
+	}
+	assert.Equal(t, len(live), wheel.Len())
+}
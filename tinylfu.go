@@ -0,0 +1,232 @@
+package ttl
+
+import (
+	"container/list"
+)
+
+const (
+	sketchDepth      = 4
+	sketchMaxCounter = 15
+	// each row has sketchWidthFactor counters per item of capacity
+	sketchWidthFactor = 4
+	// the sketch is aged once it recorded sampleFactor * width increments
+	sketchSampleFactor = 10
+)
+
+// sketchSeeds makes the hash functions of the rows of the sketch independent
+var sketchSeeds = [sketchDepth]uint64{0xc3a5c85c97cb3127, 0xb492b66fbe98f273, 0x9ae16a3b2f90404f, 0xcbf29ce484222325}
+
+// frequencySketch is a count-min sketch that estimates how often a key was seen.
+// Counters saturate at 15 and are halved periodically so that old popularity fades away.
+type frequencySketch struct {
+	rows       [sketchDepth][]uint8
+	mask       uint64
+	additions  int
+	sampleSize int
+}
+
+func newFrequencySketch(capacity int) *frequencySketch {
+	width := 64
+	for width < capacity*sketchWidthFactor {
+		width <<= 1
+	}
+	sketch := &frequencySketch{
+		mask:       uint64(width - 1),
+		sampleSize: sketchSampleFactor * width,
+	}
+	for i := range sketch.rows {
+		sketch.rows[i] = make([]uint8, width)
+	}
+	return sketch
+}
+
+// index returns the counter position of a hash in the given row
+func (s *frequencySketch) index(hash uint64, row int) uint64 {
+	return mix64(hash^sketchSeeds[row]) & s.mask
+}
+
+// Increment records one occurrence of the hash
+func (s *frequencySketch) Increment(hash uint64) {
+	incremented := false
+	for row := range s.rows {
+		i := s.index(hash, row)
+		if s.rows[row][i] < sketchMaxCounter {
+			s.rows[row][i]++
+			incremented = true
+		}
+	}
+	if incremented {
+		s.additions++
+		if s.additions >= s.sampleSize {
+			s.reset()
+		}
+	}
+}
+
+// Estimate returns the estimated frequency of the hash
+func (s *frequencySketch) Estimate(hash uint64) uint8 {
+	estimate := uint8(sketchMaxCounter)
+	for row := range s.rows {
+		if count := s.rows[row][s.index(hash, row)]; count < estimate {
+			estimate = count
+		}
+	}
+	return estimate
+}
+
+// reset halves all the counters, this is the aging process of the sketch
+func (s *frequencySketch) reset() {
+	for row := range s.rows {
+		for i := range s.rows[row] {
+			s.rows[row][i] >>= 1
+		}
+	}
+	s.additions /= 2
+}
+
+type tinyLFUSegment int
+
+const (
+	segmentWindow tinyLFUSegment = iota
+	segmentProbation
+	segmentProtected
+)
+
+type tinyLFUEntry[K comparable] struct {
+	key     K
+	hash    uint64
+	segment tinyLFUSegment
+}
+
+// TinyLFUPolicy implements W-TinyLFU: new keys enter a small LRU window and, once they
+// leave it, they have to compete with the least recently used key of the main space.
+// The key with the highest estimated frequency stays, so one-off keys can not push out
+// frequently used ones. The main space is a segmented LRU with a probation and a protected segment.
+//
+// The capacity must match the limit set with SetCacheSizeLimit.
+type TinyLFUPolicy[K comparable] struct {
+	sketch       *frequencySketch
+	window       *list.List
+	probation    *list.List
+	protected    *list.List
+	entries      map[K]*list.Element
+	windowSize   int
+	protectedMax int
+}
+
+// NewTinyLFUPolicy creates an EvictionPolicy implementing W-TinyLFU for a cache holding up to capacity items.
+// One percent of the capacity is used for the window, eighty percent of the rest is the protected segment.
+func NewTinyLFUPolicy[K comparable](capacity int) *TinyLFUPolicy[K] {
+	if capacity < 1 {
+		capacity = 1
+	}
+	windowSize := capacity / 100
+	if windowSize < 1 {
+		windowSize = 1
+	}
+	return &TinyLFUPolicy[K]{
+		sketch:       newFrequencySketch(capacity),
+		window:       list.New(),
+		probation:    list.New(),
+		protected:    list.New(),
+		entries:      make(map[K]*list.Element),
+		windowSize:   windowSize,
+		protectedMax: (capacity - windowSize) * 8 / 10,
+	}
+}
+
+func (p *TinyLFUPolicy[K]) segment(segment tinyLFUSegment) *list.List {
+	switch segment {
+	case segmentWindow:
+		return p.window
+	case segmentProbation:
+		return p.probation
+	}
+	return p.protected
+}
+
+// move takes the element out of its segment and pushes it at the front of another one
+func (p *TinyLFUPolicy[K]) move(element *list.Element, segment tinyLFUSegment) {
+	entry := p.segment(element.Value.(*tinyLFUEntry[K]).segment).Remove(element).(*tinyLFUEntry[K])
+	entry.segment = segment
+	p.entries[entry.key] = p.segment(segment).PushFront(entry)
+}
+
+// Add meets the EvictionPolicy interface
+func (p *TinyLFUPolicy[K]) Add(key K) {
+	if _, exists := p.entries[key]; exists {
+		p.Access(key)
+		return
+	}
+	entry := &tinyLFUEntry[K]{key: key, hash: hashKey(key), segment: segmentWindow}
+	p.sketch.Increment(entry.hash)
+	p.entries[key] = p.window.PushFront(entry)
+	if p.window.Len() > p.windowSize {
+		p.move(p.window.Back(), segmentProbation)
+	}
+}
+
+// Access meets the EvictionPolicy interface
+func (p *TinyLFUPolicy[K]) Access(key K) {
+	element, exists := p.entries[key]
+	if !exists {
+		return
+	}
+	entry := element.Value.(*tinyLFUEntry[K])
+	p.sketch.Increment(entry.hash)
+	switch entry.segment {
+	case segmentWindow:
+		p.window.MoveToFront(element)
+	case segmentProbation:
+		p.move(element, segmentProtected)
+		if p.protected.Len() > p.protectedMax {
+			p.move(p.protected.Back(), segmentProbation)
+		}
+	case segmentProtected:
+		p.protected.MoveToFront(element)
+	}
+}
+
+// Remove meets the EvictionPolicy interface
+func (p *TinyLFUPolicy[K]) Remove(key K) {
+	if element, exists := p.entries[key]; exists {
+		p.segment(element.Value.(*tinyLFUEntry[K]).segment).Remove(element)
+		delete(p.entries, key)
+	}
+}
+
+// Victim meets the EvictionPolicy interface. When the window is full its least recently used key
+// is the candidate to enter the main space, it is compared with the victim of the main space and
+// the one with the lowest estimated frequency is returned. The winner is moved to the probation segment.
+func (p *TinyLFUPolicy[K]) Victim() (K, bool) {
+	mainVictim := p.probation.Back()
+	if mainVictim == nil {
+		mainVictim = p.protected.Back()
+	}
+	candidate := p.window.Back()
+	if candidate == nil || (p.window.Len() < p.windowSize && mainVictim != nil) {
+		if mainVictim == nil {
+			var zero K
+			return zero, false
+		}
+		return mainVictim.Value.(*tinyLFUEntry[K]).key, true
+	}
+	if mainVictim == nil {
+		return candidate.Value.(*tinyLFUEntry[K]).key, true
+	}
+	candidateEntry := candidate.Value.(*tinyLFUEntry[K])
+	victimEntry := mainVictim.Value.(*tinyLFUEntry[K])
+	if p.sketch.Estimate(candidateEntry.hash) > p.sketch.Estimate(victimEntry.hash) {
+		p.move(candidate, segmentProbation)
+		return victimEntry.key, true
+	}
+	return candidateEntry.key, true
+}
+
+// Purge meets the EvictionPolicy interface, the frequency history is kept
+func (p *TinyLFUPolicy[K]) Purge() {
+	p.window.Init()
+	p.probation.Init()
+	p.protected.Init()
+	p.entries = make(map[K]*list.Element)
+}
@@ -0,0 +1,107 @@
+package ttl
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrequencySketch(t *testing.T) {
+	sketch := newFrequencySketch(100)
+	hot := hashKey("hot")
+	cold := hashKey("cold")
+	for i := 0; i < 10; i++ {
+		sketch.Increment(hot)
+	}
+	sketch.Increment(cold)
+	assert.Equal(t, uint8(10), sketch.Estimate(hot))
+	assert.Equal(t, uint8(1), sketch.Estimate(cold))
+
+	for i := 0; i < 20; i++ {
+		sketch.Increment(hot)
+	}
+	assert.Equal(t, uint8(sketchMaxCounter), sketch.Estimate(hot), "Expected counters to saturate")
+}
+
+func TestFrequencySketchAging(t *testing.T) {
+	sketch := newFrequencySketch(16)
+	hot := hashKey("hot")
+	for i := 0; i < 8; i++ {
+		sketch.Increment(hot)
+	}
+	sketch.additions = sketch.sampleSize - 1
+	sketch.Increment(hot)
+	assert.Equal(t, sketch.sampleSize/2, sketch.additions, "Expected the sketch to be aged")
+	assert.Equal(t, uint8(4), sketch.Estimate(hot), "Expected counters to be halved")
+}
+
+func TestTinyLFUPolicyRejectsOneOffKeys(t *testing.T) {
+	policy := NewTinyLFUPolicy[string](10)
+	assert.Equal(t, 1, policy.windowSize)
+	_, ok := policy.Victim()
+	assert.False(t, ok, "Expected an empty policy to have no victim")
+
+	for i := 0; i < 10; i++ {
+		policy.Add(fmt.Sprintf("hot%d", i))
+	}
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 10; i++ {
+			policy.Access(fmt.Sprintf("hot%d", i))
+		}
+	}
+
+	// one-off keys compete with the main space through the window and lose,
+	// the first candidate is the last hot key, it ties with the main victim
+	for i := 0; i < 10; i++ {
+		key := victim[string](t, policy)
+		policy.Remove(key)
+		policy.Add(fmt.Sprintf("cold%d", i))
+		if i == 0 {
+			assert.Equal(t, "hot9", key)
+		} else {
+			assert.Equal(t, fmt.Sprintf("cold%d", i-1), key)
+		}
+	}
+	assert.Equal(t, 10, len(policy.entries))
+	for i := 0; i < 9; i++ {
+		assert.Contains(t, policy.entries, fmt.Sprintf("hot%d", i))
+	}
+}
+
+func TestTinyLFUPolicyAdmitsFrequentKeys(t *testing.T) {
+	policy := NewTinyLFUPolicy[int](4)
+	for i := 0; i < 4; i++ {
+		policy.Add(i)
+	}
+	// a key that keeps coming back builds frequency and wins against the main victim
+	for round := 0; round < 5; round++ {
+		key := victim[int](t, policy)
+		policy.Remove(key)
+		policy.Add(100)
+		if round < 4 {
+			policy.Remove(100)
+			policy.Add(key)
+		}
+	}
+	assert.Contains(t, policy.entries, 100)
+	assert.Equal(t, 4, len(policy.entries))
+
+	policy.Remove(100)
+	policy.Purge()
+	assert.Equal(t, 0, policy.window.Len()+policy.probation.Len()+policy.protected.Len())
+	assert.Equal(t, uint8(5), policy.sketch.Estimate(hashKey(100)), "Expected frequencies to survive a purge")
+}
+
+func TestTinyLFUPolicyProtectedSegment(t *testing.T) {
+	policy := NewTinyLFUPolicy[int](11)
+	for i := 0; i < 11; i++ {
+		policy.Add(i)
+	}
+	for i := 0; i < 10; i++ {
+		policy.Access(i)
+	}
+	assert.Equal(t, policy.protectedMax, policy.protected.Len())
+	assert.Equal(t, 1, policy.window.Len())
+	assert.Equal(t, 11-1-policy.protectedMax, policy.probation.Len())
+}
@@ -0,0 +1,204 @@
+// Package ttlprometheus exports the metrics of ttl caches to Prometheus. It is a separate
+// module, so that the ttl package itself does not depend on the Prometheus client.
+package ttlprometheus
+
+import (
+	"sync"
+
+	"github.com/asgarciap/ttl/v4"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "ttl_cache"
+
+// Cache is the part of ttl.Cache and ttl.ShardedCache used by the Collector
+type Cache interface {
+	GetMetrics() ttl.Metrics
+	Count() int
+	GetCacheSizeLimit() int
+}
+
+type counter struct {
+	desc  *prometheus.Desc
+	value func(metrics ttl.Metrics) int64
+}
+
+func newCounter(name string, help string, value func(metrics ttl.Metrics) int64) counter {
+	return counter{
+		desc:  prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, []string{"cache"}, nil),
+		value: value,
+	}
+}
+
+type histogram struct {
+	desc  *prometheus.Desc
+	value func(metrics ttl.Metrics) ttl.Histogram
+}
+
+func newHistogram(name string, help string, value func(metrics ttl.Metrics) ttl.Histogram) histogram {
+	return histogram{
+		desc:  prometheus.NewDesc(prometheus.BuildFQName(namespace, "", name), help, []string{"cache"}, nil),
+		value: value,
+	}
+}
+
+// buckets converts the counts of a histogram into the cumulative counts per upper bound in seconds
+func buckets(value ttl.Histogram) map[float64]uint64 {
+	buckets := make(map[float64]uint64)
+	var cumulative uint64
+	for i, bound := range value.Bounds() {
+		cumulative += uint64(value.Counts[i])
+		buckets[bound.Seconds()] = cumulative
+	}
+	return buckets
+}
+
+var (
+	counters = []counter{
+		newCounter("inserted_total", "Items added to the cache.", func(metrics ttl.Metrics) int64 {
+			return metrics.Inserted
+		}),
+		newCounter("retrievals_total", "Get calls that found the key in the cache.", func(metrics ttl.Metrics) int64 {
+			return metrics.Retrievals
+		}),
+		newCounter("hits_total", "Get calls, whether the key was in the cache or not.", func(metrics ttl.Metrics) int64 {
+			return metrics.Hits
+		}),
+		newCounter("misses_total", "Get calls that did not find the key in the cache.", func(metrics ttl.Metrics) int64 {
+			return metrics.Misses
+		}),
+		newCounter("stale_retrievals_total", "Stale items returned while being refreshed.", func(metrics ttl.Metrics) int64 {
+			return metrics.StaleRetrievals
+		}),
+		newCounter("refreshed_total", "Items refreshed in the background by the loader.", func(metrics ttl.Metrics) int64 {
+			return metrics.Refreshed
+		}),
+		newCounter("refresh_failed_total", "Background refreshes that failed.", func(metrics ttl.Metrics) int64 {
+			return metrics.RefreshFailed
+		}),
+		newCounter("negative_inserted_total", "Loader errors added to the cache.", func(metrics ttl.Metrics) int64 {
+			return metrics.NegativeInserted
+		}),
+		newCounter("negative_hits_total", "Get calls that returned a cached loader error.", func(metrics ttl.Metrics) int64 {
+			return metrics.NegativeHits
+		}),
+		newCounter("loader_successes_total", "Loader calls that returned data.", func(metrics ttl.Metrics) int64 {
+			return metrics.LoaderSuccesses
+		}),
+		newCounter("loader_failures_total", "Loader calls that returned an error.", func(metrics ttl.Metrics) int64 {
+			return metrics.LoaderFailures
+		}),
+		newCounter("loader_deduplicated_total", "Get calls that waited for a load started by another call.", func(metrics ttl.Metrics) int64 {
+			return metrics.LoaderDeduplicated
+		}),
+		newCounter("events_dropped_total", "Events not delivered because the channel of a subscriber was full.", func(metrics ttl.Metrics) int64 {
+			return metrics.EventsDropped
+		}),
+	}
+	histograms = []histogram{
+		newHistogram("loader_duration_seconds", "Duration of the loader calls.", func(metrics ttl.Metrics) ttl.Histogram {
+			return metrics.LoaderLatency
+		}),
+		newHistogram("get_duration_seconds", "Duration of the get calls, including the time spent waiting for the loader.", func(metrics ttl.Metrics) ttl.Histogram {
+			return metrics.GetLatency
+		}),
+		newHistogram("set_duration_seconds", "Duration of the set calls.", func(metrics ttl.Metrics) ttl.Histogram {
+			return metrics.SetLatency
+		}),
+	}
+	// evictions maps the eviction reasons to their metric
+	evictions = map[ttl.EvictionReason]func(metrics ttl.Metrics) int64{
+		ttl.Removed: func(metrics ttl.Metrics) int64 {
+			return metrics.Removed
+		},
+		ttl.EvictedSize: func(metrics ttl.Metrics) int64 {
+			return metrics.EvictedFull
+		},
+		ttl.Expired: func(metrics ttl.Metrics) int64 {
+			return metrics.EvictedExpired
+		},
+		ttl.Closed: func(metrics ttl.Metrics) int64 {
+			return metrics.EvictedClosed
+		},
+		ttl.ExpiredNegative: func(metrics ttl.Metrics) int64 {
+			return metrics.EvictedNegative
+		},
+	}
+	evictionsDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "evictions_total"),
+		"Items removed from the cache, by eviction reason.", []string{"cache", "reason"}, nil)
+	itemsDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "items"),
+		"Items in the cache.", []string{"cache"}, nil)
+	sizeLimitDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "size_limit"),
+		"Limit to the amount of items in the cache, 0 when there is no limit.", []string{"cache"}, nil)
+	costDesc = prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "cost"),
+		"Total cost of the items in the cache.", []string{"cache"}, nil)
+)
+
+// Collector is a prometheus.Collector for any number of caches, the metrics of each cache
+// are labelled with its name. It is safe for concurrent use.
+type Collector struct {
+	mutex  sync.Mutex
+	caches map[string]Cache
+}
+
+// NewCollector creates a Collector without caches, see Add
+func NewCollector() *Collector {
+	return &Collector{
+		caches: make(map[string]Cache),
+	}
+}
+
+// Add exports the metrics of the cache with the given name, replacing the cache that had the same name
+func (collector *Collector) Add(name string, cache Cache) {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	collector.caches[name] = cache
+}
+
+// Remove stops exporting the metrics of the cache with the given name
+func (collector *Collector) Remove(name string) {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	delete(collector.caches, name)
+}
+
+// Describe meets the prometheus.Collector interface
+func (collector *Collector) Describe(descs chan<- *prometheus.Desc) {
+	for _, counter := range counters {
+		descs <- counter.desc
+	}
+	for _, histogram := range histograms {
+		descs <- histogram.desc
+	}
+	descs <- evictionsDesc
+	descs <- itemsDesc
+	descs <- sizeLimitDesc
+	descs <- costDesc
+}
+
+// Collect meets the prometheus.Collector interface
+func (collector *Collector) Collect(metrics chan<- prometheus.Metric) {
+	collector.mutex.Lock()
+	caches := make(map[string]Cache, len(collector.caches))
+	for name, cache := range collector.caches {
+		caches[name] = cache
+	}
+	collector.mutex.Unlock()
+
+	for name, cache := range caches {
+		cacheMetrics := cache.GetMetrics()
+		for _, counter := range counters {
+			metrics <- prometheus.MustNewConstMetric(counter.desc, prometheus.CounterValue, float64(counter.value(cacheMetrics)), name)
+		}
+		for _, histogram := range histograms {
+			value := histogram.value(cacheMetrics)
+			metrics <- prometheus.MustNewConstHistogram(histogram.desc, uint64(value.Count), value.Sum.Seconds(), buckets(value), name)
+		}
+		for reason, value := range evictions {
+			metrics <- prometheus.MustNewConstMetric(evictionsDesc, prometheus.CounterValue, float64(value(cacheMetrics)), name, reason.String())
+		}
+		metrics <- prometheus.MustNewConstMetric(itemsDesc, prometheus.GaugeValue, float64(cache.Count()), name)
+		metrics <- prometheus.MustNewConstMetric(sizeLimitDesc, prometheus.GaugeValue, float64(cache.GetCacheSizeLimit()), name)
+		metrics <- prometheus.MustNewConstMetric(costDesc, prometheus.GaugeValue, float64(cacheMetrics.Cost), name)
+	}
+}
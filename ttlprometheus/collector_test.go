@@ -0,0 +1,94 @@
+package ttlprometheus_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asgarciap/ttl/v4"
+	"github.com/asgarciap/ttl/ttlprometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollector(t *testing.T) {
+	users := ttl.NewCache[string, string]()
+	defer users.Close()
+	sessions := ttl.NewShardedCache[int, int](2)
+	defer sessions.Close()
+
+	users.SetCacheSizeLimit(2)
+	users.Set("a", "1")
+	users.Set("b", "2")
+	users.Set("c", "3")
+	users.Get("c")
+	users.GetByLoader("loaded", func(key string) (string, time.Duration, error) {
+		return "value", 0, nil
+	})
+	users.Get("missing")
+	users.Remove("c")
+	sessions.Set(1, 1)
+
+	collector := ttlprometheus.NewCollector()
+	collector.Add("users", users)
+	collector.Add("sessions", sessions)
+	removed := ttl.NewCache[string, string]()
+	defer removed.Close()
+	collector.Add("removed", removed)
+	collector.Remove("removed")
+
+	expected := `
+# HELP ttl_cache_evictions_total Items removed from the cache, by eviction reason.
+# TYPE ttl_cache_evictions_total counter
+ttl_cache_evictions_total{cache="sessions",reason="Closed"} 0
+ttl_cache_evictions_total{cache="sessions",reason="EvictedSize"} 0
+ttl_cache_evictions_total{cache="sessions",reason="Expired"} 0
+ttl_cache_evictions_total{cache="sessions",reason="ExpiredNegative"} 0
+ttl_cache_evictions_total{cache="sessions",reason="Removed"} 0
+ttl_cache_evictions_total{cache="users",reason="Closed"} 0
+ttl_cache_evictions_total{cache="users",reason="EvictedSize"} 2
+ttl_cache_evictions_total{cache="users",reason="Expired"} 0
+ttl_cache_evictions_total{cache="users",reason="ExpiredNegative"} 0
+ttl_cache_evictions_total{cache="users",reason="Removed"} 1
+# HELP ttl_cache_inserted_total Items added to the cache.
+# TYPE ttl_cache_inserted_total counter
+ttl_cache_inserted_total{cache="sessions"} 1
+ttl_cache_inserted_total{cache="users"} 4
+# HELP ttl_cache_items Items in the cache.
+# TYPE ttl_cache_items gauge
+ttl_cache_items{cache="sessions"} 1
+ttl_cache_items{cache="users"} 1
+# HELP ttl_cache_loader_successes_total Loader calls that returned data.
+# TYPE ttl_cache_loader_successes_total counter
+ttl_cache_loader_successes_total{cache="sessions"} 0
+ttl_cache_loader_successes_total{cache="users"} 1
+# HELP ttl_cache_misses_total Get calls that did not find the key in the cache.
+# TYPE ttl_cache_misses_total counter
+ttl_cache_misses_total{cache="sessions"} 0
+ttl_cache_misses_total{cache="users"} 2
+# HELP ttl_cache_size_limit Limit to the amount of items in the cache, 0 when there is no limit.
+# TYPE ttl_cache_size_limit gauge
+ttl_cache_size_limit{cache="sessions"} 0
+ttl_cache_size_limit{cache="users"} 2
+`
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected),
+		"ttl_cache_evictions_total", "ttl_cache_inserted_total", "ttl_cache_items", "ttl_cache_loader_successes_total", "ttl_cache_misses_total", "ttl_cache_size_limit")
+	assert.Nil(t, err)
+
+	// a pedantic registry verifies the histograms as well
+	registry := prometheus.NewPedanticRegistry()
+	assert.Nil(t, registry.Register(collector))
+	families, err := registry.Gather()
+	assert.Nil(t, err)
+	getCalls := map[string]uint64{}
+	for _, family := range families {
+		if family.GetName() == "ttl_cache_get_duration_seconds" {
+			for _, metric := range family.GetMetric() {
+				getCalls[metric.GetLabel()[0].GetValue()] = metric.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+	assert.Equal(t, map[string]uint64{"users": 3, "sessions": 0}, getCalls)
+	assert.Equal(t, 2*(13+3+5+3), testutil.CollectAndCount(collector))
+}
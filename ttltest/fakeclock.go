@@ -0,0 +1,153 @@
+// Package ttltest provides utilities to test code that uses a ttl cache.
+package ttltest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/asgarciap/ttl/v4"
+)
+
+// FakeClock is a ttl.Clock that only moves when it is told to, so that the expiration of a cache can be
+// tested without sleeping:
+//
+//	clock := ttltest.NewFakeClock(time.Now())
+//	cache.SetClock(clock)
+//	cache.SetWithTTL("key", "value", time.Minute)
+//	clock.Advance(time.Minute) // "key" is expired and its expiration callbacks are started
+//
+// Advance fires the timers that are due and waits for each of them to be reset or stopped, which the
+// expiration processing of a cache does once it has removed the expired items.
+type FakeClock struct {
+	mutex  sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	timers map[*fakeTimer]struct{}
+}
+
+// NewFakeClock creates a FakeClock set at now
+func NewFakeClock(now time.Time) *FakeClock {
+	clock := &FakeClock{
+		now:    now,
+		timers: make(map[*fakeTimer]struct{}),
+	}
+	clock.cond = sync.NewCond(&clock.mutex)
+	return clock
+}
+
+// Now returns the time the clock is at
+func (clock *FakeClock) Now() time.Time {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	return clock.now
+}
+
+// NewTimer creates a timer that fires once the clock is advanced by d
+func (clock *FakeClock) NewTimer(d time.Duration) ttl.Timer {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	timer := &fakeTimer{clock: clock, c: make(chan time.Time, 1)}
+	clock.timers[timer] = struct{}{}
+	timer.arm(d)
+	return timer
+}
+
+// Advance moves the clock forward by d. It returns once the timers that are due have fired, in the order of their
+// deadlines, and have been reset or stopped by their owners. The timers that are due again once reset fire as well.
+func (clock *FakeClock) Advance(d time.Duration) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	clock.now = clock.now.Add(d)
+	for {
+		if clock.firing() {
+			clock.cond.Wait()
+			continue
+		}
+		var next *fakeTimer
+		for timer := range clock.timers {
+			if timer.armed && !timer.deadline.After(clock.now) && (next == nil || timer.deadline.Before(next.deadline)) {
+				next = timer
+			}
+		}
+		if next == nil {
+			return
+		}
+		next.fire()
+	}
+}
+
+// firing reports whether a timer fired and was not reset or stopped yet
+func (clock *FakeClock) firing() bool {
+	for timer := range clock.timers {
+		if timer.fired {
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTimer struct {
+	clock    *FakeClock
+	c        chan time.Time
+	deadline time.Time
+	armed    bool
+	// fired is set from the time the timer fires until it is reset or stopped
+	fired bool
+}
+
+func (timer *fakeTimer) C() <-chan time.Time {
+	return timer.c
+}
+
+// Stop prevents the timer from firing, it returns false when the timer was not armed
+func (timer *fakeTimer) Stop() bool {
+	timer.clock.mutex.Lock()
+	defer timer.clock.mutex.Unlock()
+	armed := timer.armed
+	timer.drain()
+	timer.armed = false
+	timer.fired = false
+	delete(timer.clock.timers, timer)
+	timer.clock.cond.Broadcast()
+	return armed
+}
+
+// Reset changes the timer to fire once the clock is advanced by d, it returns false when the timer was not armed
+func (timer *fakeTimer) Reset(d time.Duration) bool {
+	timer.clock.mutex.Lock()
+	defer timer.clock.mutex.Unlock()
+	armed := timer.armed
+	timer.drain()
+	timer.clock.timers[timer] = struct{}{}
+	timer.arm(d)
+	timer.clock.cond.Broadcast()
+	return armed
+}
+
+// arm sets the deadline of the timer, a timer that is already due fires right away. The clock must be locked.
+func (timer *fakeTimer) arm(d time.Duration) {
+	timer.deadline = timer.clock.now.Add(d)
+	timer.armed = true
+	timer.fired = false
+	if d <= 0 {
+		timer.fire()
+	}
+}
+
+// fire sends the time on the channel of the timer. The clock must be locked.
+func (timer *fakeTimer) fire() {
+	timer.armed = false
+	timer.fired = true
+	select {
+	case timer.c <- timer.clock.now:
+	default:
+	}
+}
+
+// drain removes a time the owner did not receive, as the timer was stopped or reset
+func (timer *fakeTimer) drain() {
+	select {
+	case <-timer.c:
+	default:
+	}
+}
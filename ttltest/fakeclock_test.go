@@ -0,0 +1,47 @@
+package ttltest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/asgarciap/ttl/v4/ttltest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeClock_Timers(t *testing.T) {
+	start := time.Unix(0, 0)
+	clock := ttltest.NewFakeClock(start)
+	fired := make(chan time.Time, 10)
+
+	// the timer owner records when it fired and stops, as an expiration processing would
+	timer := clock.NewTimer(time.Minute)
+	go func() {
+		at := <-timer.C()
+		fired <- at
+		timer.Stop()
+	}()
+	clock.Advance(30 * time.Second)
+	assert.Len(t, fired, 0)
+	clock.Advance(time.Minute)
+	assert.Len(t, fired, 1, "Advance waits for the timer to be stopped")
+	assert.Equal(t, start.Add(90*time.Second), <-fired)
+	assert.Equal(t, start.Add(90*time.Second), clock.Now())
+
+	// a timer that is reset to a time that is already due fires again within the same Advance
+	timer = clock.NewTimer(time.Second)
+	go func() {
+		for i := 0; i < 3; i++ {
+			fired <- <-timer.C()
+			timer.Reset(time.Duration(i-1) * time.Second)
+		}
+		timer.Stop()
+	}()
+	clock.Advance(time.Hour)
+	assert.Len(t, fired, 3)
+
+	stopped := clock.NewTimer(time.Second)
+	assert.True(t, stopped.Stop())
+	assert.False(t, stopped.Stop())
+	clock.Advance(time.Hour)
+	assert.Len(t, stopped.C(), 0)
+}
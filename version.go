@@ -0,0 +1,93 @@
+package ttl
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// VersionMismatchError is returned by SetIfVersion when the key changed since the expected version was read
+type VersionMismatchError struct {
+	// Expected is the version given to SetIfVersion
+	Expected uint64
+	// Current is the version of the key in the cache, 0 when the key is not in the cache
+	Current uint64
+}
+
+func (err VersionMismatchError) Error() string {
+	return fmt.Sprintf("%s: expected %d, current %d", ErrVersionMismatch, err.Expected, err.Current)
+}
+
+// Is makes errors.Is(err, ErrVersionMismatch) true
+func (err VersionMismatchError) Is(target error) bool {
+	return target == ErrVersionMismatch
+}
+
+// GetVersioned is like Get but it also returns the version of the item, to be given to SetIfVersion.
+// Every change of the item gets a higher version, Touch and the TTL extension of Get do not change it.
+// The loader function is not called for missing keys, they return ErrNotFound and version 0.
+func (cache *Cache[K, V]) GetVersioned(key K) (V, uint64, error) {
+	defer cache.getLatency.observe(time.Now())
+	var zero V
+	cache.mutex.Lock()
+	if cache.isShutDown {
+		cache.mutex.Unlock()
+		return zero, 0, ErrClosed
+	}
+	cache.metrics.Hits++
+	item, exists, triggerExpirationNotification := cache.getItem(key)
+	if !exists {
+		cache.metrics.Misses++
+		cache.mutex.Unlock()
+		if triggerExpirationNotification {
+			cache.notifyExpiration()
+		}
+		return zero, 0, ErrNotFound
+	}
+	if cache.evictionPolicy != nil {
+		cache.evictionPolicy.Access(key)
+	}
+	if item.err != nil {
+		cache.metrics.NegativeHits++
+		err := item.err
+		cache.mutex.Unlock()
+		return zero, 0, err
+	}
+	cache.metrics.Retrievals++
+	stale := item.isStale(cache.clock.Now())
+	if stale {
+		cache.metrics.StaleRetrievals++
+	}
+	data, version := item.data, item.version
+	if cache.loaderFunction != nil && stale {
+		cache.refresh(context.Background(), key, cache.loaderFunction)
+	}
+	cache.mutex.Unlock()
+	if triggerExpirationNotification {
+		cache.notifyExpiration()
+	}
+	return data, version, nil
+}
+
+// SetIfVersion sets the item only when the key still has the given version, as returned by GetVersioned,
+// version 0 expects the key not to be in the cache. Returns a VersionMismatchError otherwise.
+func (cache *Cache[K, V]) SetIfVersion(key K, data V, ttl time.Duration, version uint64) error {
+	defer cache.setLatency.observe(time.Now())
+	cache.mutex.Lock()
+	if cache.isShutDown {
+		cache.mutex.Unlock()
+		return ErrClosed
+	}
+	current := uint64(0)
+	if item, exists := cache.lookup(key); exists {
+		current = item.version
+	}
+	if current != version {
+		cache.mutex.Unlock()
+		return VersionMismatchError{Expected: version, Current: current}
+	}
+	isNew, err := cache.store(key, data, ttl)
+	cache.mutex.Unlock()
+	cache.stored(isNew, key, data)
+	return err
+}
@@ -0,0 +1,384 @@
+package ttl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	walFile           = "wal"
+	walCompactingFile = "wal.compacting"
+	walSnapshotFile   = "snapshot"
+)
+
+// WALSyncAlways makes every operation sync the write-ahead log to disk before it returns, see SetWALSync
+const WALSyncAlways time.Duration = -1
+
+type walOperation byte
+
+const (
+	walSet walOperation = iota + 1
+	walRemove
+	walTouch
+	walPurge
+)
+
+// writeAheadLog is the log file of a cache, see OpenWAL
+type writeAheadLog struct {
+	dir              string
+	file             *os.File
+	size             int64
+	compactThreshold int64
+	compacting       bool
+	// compactErr is the error of the last failed compaction, no compaction is started afterwards
+	compactErr error
+	compaction sync.WaitGroup
+	// syncInterval is how the log is synced to disk, see SetWALSync
+	syncInterval time.Duration
+	// syncTimer syncs the records written since it was started, nil when there are none
+	syncTimer *time.Timer
+	syncs     sync.WaitGroup
+	// err is the error of a record written in the background, returned by the next operation
+	err error
+}
+
+// OpenWAL makes the cache durable: the items saved in dir are restored and every Set, SetWithTTL,
+// SetWithCost, Remove, Touch and Purge is recorded in a log in dir from now on, before it returns.
+// Once the log grows past compactThreshold bytes it is compacted into a snapshot in the background,
+// set to 0 to never compact. Items that expired in the meantime are dropped when the log is replayed,
+// the TTL extensions of Get are not recorded. The log is written with the Codec of the cache and it is
+// closed by Close. The operations return the errors writing the log, the cache is changed regardless.
+// The items evicted for the size limit or the max cost are recorded as removed. Once an operation returns
+// its record is in the operating system, it survives a crash of the process, the records that have to
+// survive a crash of the machine are set by SetWALSync.
+func (cache *Cache[K, V]) OpenWAL(dir string, compactThreshold int64) error {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if cache.isShutDown {
+		return ErrClosed
+	}
+	if cache.wal != nil {
+		return ErrWALOpen
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	keyCodec, valueCodec := cache.codecs()
+	file, err := os.Open(filepath.Join(dir, walSnapshotFile))
+	if err == nil {
+		entries, err := readSnapshot(file, keyCodec, valueCodec)
+		file.Close()
+		if err != nil {
+			return err
+		}
+		if err := cache.restoreLocked(entries); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	// a compaction that did not finish left the records that preceded the current log
+	for _, name := range []string{walCompactingFile, walFile} {
+		if err := cache.replayWAL(filepath.Join(dir, name), keyCodec, valueCodec); err != nil {
+			return err
+		}
+	}
+	// start from a clean snapshot, the log is empty again
+	if err := writeSnapshotFile(filepath.Join(dir, walSnapshotFile), cache.snapshot(), keyCodec, valueCodec); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(dir, walCompactingFile)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	file, err = os.OpenFile(filepath.Join(dir, walFile), os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	cache.wal = &writeAheadLog{
+		dir:              dir,
+		file:             file,
+		compactThreshold: compactThreshold,
+		syncInterval:     cache.walSync,
+	}
+	cache.notifyExpiration()
+	return nil
+}
+
+// SetWALSync sets when the write-ahead log is synced to disk. With 0, the default, the log is synced only
+// when it is compacted or closed, the records written before a crash of the machine can be lost. With a
+// positive interval the log is synced in the background at most interval after a record is written, only
+// the records of the last interval can be lost. With WALSyncAlways every operation syncs the log before it
+// returns and no record is lost. The errors syncing in the background are returned by the next operation.
+func (cache *Cache[K, V]) SetWALSync(interval time.Duration) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.walSync = interval
+	if cache.wal != nil {
+		cache.wal.syncInterval = interval
+	}
+}
+
+// replayWAL applies the records of a log file to the cache. A record that was not completely
+// written, because the process crashed, ends the log.
+func (cache *Cache[K, V]) replayWAL(path string, keyCodec Codec[K], valueCodec Codec[V]) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	for {
+		err := cache.replayRecord(reader, keyCodec, valueCodec)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// replayRecord reads one record of the log and applies it
+func (cache *Cache[K, V]) replayRecord(reader *bufio.Reader, keyCodec Codec[K], valueCodec Codec[V]) error {
+	operation, err := reader.ReadByte()
+	if err != nil {
+		return err
+	}
+	timestamp, err := binary.ReadVarint(reader)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	at := time.Unix(0, timestamp)
+	switch walOperation(operation) {
+	case walSet:
+		entry, err := readSnapshotEntry(reader, keyCodec, valueCodec)
+		if err != nil {
+			return err
+		}
+		if entry.ttl > 0 {
+			entry.expireAt = at.Add(entry.ttl)
+		}
+		if current, exists := cache.items[entry.key]; exists {
+			cache.detachItem(current)
+		}
+		return cache.restoreLocked([]snapshotEntry[K, V]{entry})
+	case walRemove, walTouch:
+		data, err := readBytes(reader)
+		if err != nil {
+			return err
+		}
+		key, err := keyCodec.Decode(data)
+		if err != nil {
+			return err
+		}
+		item, exists := cache.items[key]
+		if !exists {
+			return nil
+		}
+		if walOperation(operation) == walRemove {
+			cache.detachItem(item)
+		} else if item.ttl > 0 {
+			item.setExpireAt(at.Add(item.ttl))
+			cache.expirationQueue.Update(item)
+		}
+	case walPurge:
+		cache.purge()
+	default:
+		return ErrInvalidSnapshot
+	}
+	return nil
+}
+
+// logSet records that an item was set
+func (cache *Cache[K, V]) logSet(item *item[K, V]) error {
+	if cache.wal == nil {
+		return nil
+	}
+	keyCodec, valueCodec := cache.codecs()
+	return cache.writeRecord(walSet, func(writer *bufio.Writer) error {
+		entry := snapshotEntry[K, V]{key: item.key, data: item.data, ttl: item.ttl, cost: item.cost, version: item.version, tags: item.tags}
+		return writeSnapshotEntry(writer, entry, keyCodec, valueCodec)
+	})
+}
+
+// logKey records a Remove or Touch of a key
+func (cache *Cache[K, V]) logKey(operation walOperation, key K) error {
+	if cache.wal == nil {
+		return nil
+	}
+	keyCodec, _ := cache.codecs()
+	return cache.writeRecord(operation, func(writer *bufio.Writer) error {
+		data, err := keyCodec.Encode(key)
+		if err != nil {
+			return err
+		}
+		writeBytes(writer, data)
+		return nil
+	})
+}
+
+// logPurge records a Purge
+func (cache *Cache[K, V]) logPurge() error {
+	if cache.wal == nil {
+		return nil
+	}
+	return cache.writeRecord(walPurge, func(writer *bufio.Writer) error {
+		return nil
+	})
+}
+
+// logEviction records that an item was evicted to make room for another, the error is returned by the operation that caused it
+func (cache *Cache[K, V]) logEviction(key K) {
+	if cache.wal == nil {
+		return
+	}
+	if err := cache.logKey(walRemove, key); err != nil && cache.wal.err == nil {
+		cache.wal.err = err
+	}
+}
+
+// writeRecord appends a record to the log with a single write, syncs it as set by SetWALSync
+// and starts a compaction when the log got too big
+func (cache *Cache[K, V]) writeRecord(operation walOperation, writeFields func(writer *bufio.Writer) error) error {
+	var buffer bytes.Buffer
+	writer := bufio.NewWriter(&buffer)
+	writer.WriteByte(byte(operation))
+	writeVarint(writer, cache.clock.Now().UnixNano())
+	if err := writeFields(writer); err != nil {
+		return err
+	}
+	writer.Flush()
+	wal := cache.wal
+	written, err := wal.file.Write(buffer.Bytes())
+	wal.size += int64(written)
+	if err != nil {
+		return err
+	}
+	switch {
+	case wal.syncInterval == WALSyncAlways:
+		if err := wal.file.Sync(); err != nil {
+			return err
+		}
+	case wal.syncInterval > 0 && wal.syncTimer == nil:
+		wal.syncs.Add(1)
+		wal.syncTimer = time.AfterFunc(wal.syncInterval, func() {
+			cache.syncWAL(wal)
+		})
+	}
+	if wal.err != nil {
+		err, wal.err = wal.err, nil
+		return err
+	}
+	if wal.compactThreshold > 0 && wal.size >= wal.compactThreshold && !wal.compacting && wal.compactErr == nil {
+		return cache.compactWAL()
+	}
+	return nil
+}
+
+// syncWAL syncs the log for the timer started by writeRecord
+func (cache *Cache[K, V]) syncWAL(wal *writeAheadLog) {
+	defer wal.syncs.Done()
+	cache.mutex.Lock()
+	wal.syncTimer = nil
+	file := wal.file
+	cache.mutex.Unlock()
+	err := file.Sync()
+	cache.mutex.Lock()
+	// the file is closed once it is replaced by a compaction, it was synced before
+	if err != nil && file == wal.file && wal.err == nil {
+		wal.err = err
+	}
+	cache.mutex.Unlock()
+}
+
+// compactWAL moves the log aside and writes a snapshot of the items in the background, the log
+// is deleted once the snapshot is on disk. Until then, records go to a new log.
+func (cache *Cache[K, V]) compactWAL() error {
+	wal := cache.wal
+	entries := cache.snapshot()
+	keyCodec, valueCodec := cache.codecs()
+	if err := wal.file.Sync(); err != nil {
+		return err
+	}
+	if err := wal.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(filepath.Join(wal.dir, walFile), filepath.Join(wal.dir, walCompactingFile)); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filepath.Join(wal.dir, walFile), os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	wal.file = file
+	wal.size = 0
+	wal.compacting = true
+	wal.compaction.Add(1)
+	go func() {
+		defer wal.compaction.Done()
+		err := writeSnapshotFile(filepath.Join(wal.dir, walSnapshotFile), entries, keyCodec, valueCodec)
+		if err == nil {
+			err = os.Remove(filepath.Join(wal.dir, walCompactingFile))
+		}
+		cache.mutex.Lock()
+		wal.compacting = false
+		wal.compactErr = err
+		cache.mutex.Unlock()
+	}()
+	return nil
+}
+
+// closeWAL waits for the compaction and the sync in progress, then it syncs and closes the log
+func (cache *Cache[K, V]) closeWAL() error {
+	cache.mutex.Lock()
+	wal := cache.wal
+	cache.wal = nil
+	if wal != nil && wal.syncTimer != nil && wal.syncTimer.Stop() {
+		wal.syncTimer = nil
+		wal.syncs.Done()
+	}
+	cache.mutex.Unlock()
+	if wal == nil {
+		return nil
+	}
+	wal.compaction.Wait()
+	wal.syncs.Wait()
+	err := wal.err
+	if syncErr := wal.file.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := wal.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// writeSnapshotFile replaces the file at path with a snapshot of the entries, the
+// previous snapshot stays in place when writing the new one fails
+func writeSnapshotFile[K comparable, V any](path string, entries []snapshotEntry[K, V], keyCodec Codec[K], valueCodec Codec[V]) error {
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	err = writeSnapshot(file, entries, keyCodec, valueCodec)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
@@ -0,0 +1,178 @@
+package ttl_test
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/asgarciap/ttl/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// reopen closes the cache and opens a new one on the same write-ahead log
+func reopen(t *testing.T, cache *Cache[string, string], dir string) *Cache[string, string] {
+	assert.Nil(t, cache.Close())
+	restored := NewCache[string, string]()
+	assert.Nil(t, restored.OpenWAL(dir, 0))
+	return restored
+}
+
+func TestWAL_Replay(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	cache := NewCache[string, string]()
+	assert.Nil(t, cache.OpenWAL(dir, 0))
+	assert.Equal(t, ErrWALOpen, cache.OpenWAL(dir, 0))
+
+	cache.SetTTL(time.Hour)
+	cache.Set("a", "1")
+	cache.SetWithTTL("b", "2", ItemNotExpire)
+	cache.SetWithTTL("c", "3", 50*time.Millisecond)
+	cache.SetWithTTL("short", "4", 10*time.Millisecond)
+	cache.Set("a", "updated")
+	assert.Nil(t, cache.Remove("b"))
+	<-time.After(30 * time.Millisecond)
+	assert.Nil(t, cache.Touch("c"))
+
+	cache = reopen(t, cache, dir)
+	defer cache.Close()
+	assert.ElementsMatch(t, []string{"a", "c"}, cache.GetKeys())
+	data, err := cache.Get("a")
+	assert.Nil(t, err)
+	assert.Equal(t, "updated", data)
+
+	// the touch was replayed, the item expires 50ms after it
+	cache.SkipTTLExtensionOnHit(true)
+	_, ttl, err := cache.GetWithTTL("c")
+	assert.Nil(t, err)
+	assert.Greater(t, ttl, 30*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		return cache.Count() == 1
+	}, time.Second, time.Millisecond)
+}
+
+func TestWAL_Purge(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	cache := NewCache[string, string]()
+	assert.Nil(t, cache.OpenWAL(dir, 0))
+
+	cache.Set("a", "1")
+	assert.Nil(t, cache.Purge())
+	cache.Set("b", "2")
+
+	cache = reopen(t, cache, dir)
+	defer cache.Close()
+	assert.Equal(t, []string{"b"}, cache.GetKeys())
+}
+
+func TestWAL_TornRecord(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	cache := NewCache[string, string]()
+	assert.Nil(t, cache.OpenWAL(dir, 0))
+	cache.Set("a", "1")
+	cache.Set("b", "2")
+	assert.Nil(t, cache.Close())
+
+	// the process crashed while writing the last record
+	path := filepath.Join(dir, "wal")
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Nil(t, os.Truncate(path, info.Size()-1))
+
+	cache = NewCache[string, string]()
+	defer cache.Close()
+	assert.Nil(t, cache.OpenWAL(dir, 0))
+	assert.Equal(t, []string{"a"}, cache.GetKeys())
+}
+
+func TestWAL_Compaction(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	cache := NewCache[string, string]()
+	assert.Nil(t, cache.OpenWAL(dir, 512))
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, cache.Set(strconv.Itoa(i), "value"))
+	}
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(dir, "wal.compacting"))
+		return os.IsNotExist(err)
+	}, time.Second, time.Millisecond)
+	// the compacted records are in the snapshot, which can be loaded on its own
+	file, err := os.Open(filepath.Join(dir, "snapshot"))
+	assert.Nil(t, err)
+	snapshot := NewCache[string, string]()
+	assert.Nil(t, snapshot.Load(file))
+	assert.Greater(t, snapshot.Count(), 0)
+	file.Close()
+	snapshot.Close()
+
+	cache = reopen(t, cache, dir)
+	defer cache.Close()
+	assert.Equal(t, 100, cache.Count())
+}
+
+func TestWAL_VersionsAndTags(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	cache := NewCache[string, string]()
+	assert.Nil(t, cache.OpenWAL(dir, 0))
+
+	cache.Set("a", "1")
+	cache.SetWithTags("b", "1", ItemNotExpire, "tag")
+	cache.Set("a", "2")
+	_, version, err := cache.GetVersioned("a")
+	assert.Nil(t, err)
+
+	cache = reopen(t, cache, dir)
+	defer cache.Close()
+	_, replayed, err := cache.GetVersioned("a")
+	assert.Nil(t, err)
+	assert.Equal(t, version, replayed)
+	assert.Nil(t, cache.SetIfVersion("a", "3", ItemNotExpire, version))
+	removed, err := cache.RemoveByTag("tag")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, removed)
+}
+
+func TestWAL_Evictions(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	cache := NewCache[string, string]()
+	cache.SetCacheSizeLimit(2)
+	assert.Nil(t, cache.OpenWAL(dir, 0))
+
+	cache.SetWithTTL("a", "1", time.Hour)
+	cache.SetWithTTL("b", "2", 2*time.Hour)
+	cache.SetWithTTL("c", "3", 3*time.Hour)
+
+	// the restored cache has no limit, the evicted item is not replayed
+	cache = reopen(t, cache, dir)
+	defer cache.Close()
+	assert.ElementsMatch(t, []string{"b", "c"}, cache.GetKeys())
+}
+
+func TestWAL_Sync(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	cache := NewCache[string, string]()
+	cache.SetWALSync(WALSyncAlways)
+	assert.Nil(t, cache.OpenWAL(dir, 0))
+	assert.Nil(t, cache.Set("a", "1"))
+
+	cache.SetWALSync(time.Millisecond)
+	assert.Nil(t, cache.Set("b", "2"))
+	<-time.After(10 * time.Millisecond)
+	assert.Nil(t, cache.Set("c", "3"))
+	// the sync that is pending is done by Close
+	cache.SetWALSync(time.Hour)
+	assert.Nil(t, cache.Set("d", "4"))
+
+	cache = reopen(t, cache, dir)
+	defer cache.Close()
+	assert.ElementsMatch(t, []string{"a", "b", "c", "d"}, cache.GetKeys())
+}